@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// defaultConfigFile is read from the home directory when -config isn't given
+const defaultConfigFile = ".klogs-needle.yaml"
+
+// Flags that can't be set from a config file
+var configExcludedFlags = map[string]bool{"config": true, "help": true, "h": true, "version": true}
+
+// Set the flags not given on the command line from a YAML config file whose keys are flag names;
+// a missing file is only an error when it was named explicitly
+func applyConfigFile(flags *flag.FlagSet, path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("invalid config file '%s': %v", path, err)
+	}
+
+	// Flags given on the command line override the file
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil || configExcludedFlags[name] {
+			return fmt.Errorf("unknown key '%s' in config file '%s'", name, path)
+		}
+		if given[name] {
+			continue
+		}
+
+		// A list sets a repeatable flag once per item
+		items, ok := values[name].([]any)
+		if !ok {
+			items = []any{values[name]}
+		}
+		for _, item := range items {
+			value, err := configValue(item)
+			if err == nil {
+				err = flags.Set(name, value)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid value for '%s' in config file '%s': %v", name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Prefix of the environment variables setting flag defaults
+const envPrefix = "KLOGS_"
+
+// Flags that can't be set from the environment
+var envExcludedFlags = map[string]bool{"help": true, "h": true, "version": true}
+
+// Environment variable holding the default of a flag, e.g. KLOGS_POD_TIMEOUT for -pod-timeout
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Set the flags not given on the command line from their KLOGS_* environment variables
+func applyEnv(flags *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	given := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] || envExcludedFlags[f.Name] {
+			return
+		}
+		value, ok := lookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := flags.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value for '%s' in environment variable %s: %v", f.Name, envName(f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// Format a config file value as it would be written on the command line
+func configValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("expected a string, number or boolean")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// Repeat the search every args.Interval until ctx is done, printing a line for the first outcome
+// and whenever the pattern appears or disappears. Each search is bounded by -timeout.
+func runDaemon(ctx context.Context, searcher *needle.Searcher, args Args, stdout, stderr io.Writer) {
+	ticker := time.NewTicker(args.Interval)
+	defer ticker.Stop()
+
+	report := func(event, outcome string) {
+		fmt.Fprintf(stdout, "%s %s: Pattern %s %s in logs of %s\n",
+			time.Now().Format(time.RFC3339), event, describePatterns(args), outcome, describeTarget(args))
+	}
+
+	// The found state of the last successful search, if any
+	var known, found bool
+	for {
+		searchCtx, cancel := context.WithTimeout(ctx, args.Timeout)
+		start := time.Now()
+		result, err := searcher.Search(searchCtx, args.Options)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err != nil:
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+		case !known && result.Found:
+			report("Found", "found")
+		case !known:
+			report("Not found", "not found")
+		case result.Found && !found:
+			report("Appeared", "found")
+		case !result.Found && found:
+			report("Disappeared", "no longer found")
+		}
+
+		// Notify the webhooks and run -on-found each time the pattern is found after not being found
+		if err == nil && result.Found && (!known || !found) {
+			notifyMatch(stderr, args, result, time.Since(start))
+			if args.OnFound != "" {
+				if hookErr := runOnFound(ctx, args, result, stdout, stderr); hookErr != nil {
+					fmt.Fprintf(stderr, "Warning: %v\n", hookErr)
+				}
+			}
+		}
+		if err == nil {
+			known, found = true, result.Found
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
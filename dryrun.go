@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// Print the pods a search would cover, preceded by the discovery messages explaining the skipped
+// ones, without opening any log stream
+func runDryRun(ctx context.Context, searcher *needle.Searcher, args Args, stdout io.Writer) error {
+	// The skip reasons are part of the answer, so they go to stdout at least at discovery verbosity
+	discovery := *searcher
+	discovery.Stderr = stdout
+	if discovery.Verbosity < needle.VerbosityDiscovery {
+		discovery.Verbosity = needle.VerbosityDiscovery
+	}
+
+	pods, err := discovery.DiscoverPods(ctx, args.Options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Would search %d pods of %s:\n", len(pods), describeTarget(args))
+	for _, pod := range pods {
+		name := pod.Name
+		if spansNamespaces(args) {
+			name = pod.Namespace + "/" + pod.Name
+		}
+		fmt.Fprintf(stdout, "  %s (phase: %s)\n", name, pod.Status.Phase)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// heartbeat prints a line at a fixed interval while a search runs, so that a long wait without
+// output doesn't look hung
+type heartbeat struct {
+	mu     sync.Mutex
+	out    io.Writer
+	status map[string]needle.PodStatus
+}
+
+// Create a heartbeat printing to out
+func newHeartbeat(out io.Writer) *heartbeat {
+	return &heartbeat{out: out, status: make(map[string]needle.PodStatus)}
+}
+
+// Check whether the heartbeat is printed: -quiet and machine-readable outputs disable it
+func useHeartbeat(args Args) bool {
+	return args.Heartbeat > 0 && !args.Quiet && !reportOutput(args)
+}
+
+// Record the status of a pod of a resource search
+func (h *heartbeat) update(namespace, podName string, status needle.PodStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status[namespace+"/"+podName] = status
+}
+
+// Print a heartbeat line every interval until ctx is done
+func (h *heartbeat) run(ctx context.Context, interval time.Duration) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fmt.Fprintln(h.out, h.line(time.Since(start)))
+		}
+	}
+}
+
+// Heartbeat line after elapsed, e.g. "Still searching... (30s elapsed, 2/5 pods matched)"
+func (h *heartbeat) line(elapsed time.Duration) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seconds := int(elapsed.Round(time.Second) / time.Second)
+	if len(h.status) == 0 {
+		return fmt.Sprintf("Still searching... (%ds elapsed)", seconds)
+	}
+	matched := 0
+	for _, status := range h.status {
+		if status == needle.PodMatched {
+			matched++
+		}
+	}
+	return fmt.Sprintf("Still searching... (%ds elapsed, %d/%d pods matched)", seconds, matched, len(h.status))
+}
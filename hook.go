@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// Run the -on-found command through the shell, describing the match in KLOGS_* environment
+// variables: the first matching pod, its namespace and matched line, every matching pod and the
+// searched target
+func runOnFound(ctx context.Context, args Args, result needle.Result, stdout, stderr io.Writer) error {
+	var first needle.PodSearchResult
+	var matched []string
+	for _, pod := range result.Pods {
+		if !pod.Found {
+			continue
+		}
+		if len(matched) == 0 {
+			first = pod
+		}
+		matched = append(matched, pod.PodName)
+	}
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", args.OnFound)
+	cmd.Env = append(os.Environ(),
+		"KLOGS_POD="+first.PodName,
+		"KLOGS_NAMESPACE="+first.Namespace,
+		"KLOGS_MATCH="+first.MatchedLine,
+		"KLOGS_PODS="+strings.Join(matched, " "),
+		"KLOGS_TARGET="+describeTarget(args),
+	)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-on-found command failed: %v", err)
+	}
+	return nil
+}
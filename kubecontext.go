@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Namespace of the service account when running inside a cluster
+const inClusterNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// kubeContext is the cluster configuration a search would use
+type kubeContext struct {
+	Name      string
+	Server    string
+	Namespace string
+}
+
+// Resolve the context, API server and default namespace the search would connect with,
+// checking the configuration sources in the same order as buildRestConfig
+func resolveKubeContext(args Args) (kubeContext, error) {
+	if args.Token != "" && args.Server != "" {
+		return kubeContext{Name: "(none, using -server and -token)", Server: args.Server}, nil
+	}
+	if config, err := rest.InClusterConfig(); err == nil {
+		current := kubeContext{Name: "(in-cluster)", Server: config.Host}
+		if data, err := os.ReadFile(inClusterNamespaceFile); err == nil {
+			current.Namespace = strings.TrimSpace(string(data))
+		}
+		return current, nil
+	}
+
+	if _, err := os.Stat(args.KubeConfig); os.IsNotExist(err) {
+		return kubeContext{}, fmt.Errorf("kubeconfig file not found at %s: %v", args.KubeConfig, err)
+	}
+	loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: args.KubeConfig}
+	raw, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return kubeContext{}, fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+
+	name := raw.CurrentContext
+	if args.KubeContext != "" {
+		name = args.KubeContext
+	}
+	if name == "" {
+		return kubeContext{}, fmt.Errorf("no current context in kubeconfig '%s'", args.KubeConfig)
+	}
+	context, ok := raw.Contexts[name]
+	if !ok {
+		return kubeContext{}, fmt.Errorf("context '%s' not found in kubeconfig '%s'", name, args.KubeConfig)
+	}
+
+	current := kubeContext{Name: name, Namespace: context.Namespace}
+	if cluster, ok := raw.Clusters[context.Cluster]; ok {
+		current.Server = cluster.Server
+	}
+	return current, nil
+}
+
+// Print the context, API server and namespaces a search would use
+func writeKubeContext(w io.Writer, args Args) error {
+	current, err := resolveKubeContext(args)
+	if err != nil {
+		return err
+	}
+	server, namespace := current.Server, current.Namespace
+	if server == "" {
+		server = "(unknown)"
+	}
+	if namespace == "" {
+		namespace = "(not set)"
+	}
+	fmt.Fprintf(w, "  %-18s %s\n", "Context", current.Name)
+	fmt.Fprintf(w, "  %-18s %s\n", "Server", server)
+	fmt.Fprintf(w, "  %-18s %s\n", "Default namespace", namespace)
+	fmt.Fprintf(w, "  %-18s %s\n", "Search namespace", searchNamespace(args))
+	return nil
+}
+
+// Namespace the search would look in
+func searchNamespace(args Args) string {
+	if args.AllNamespaces {
+		return "(all namespaces)"
+	}
+	if args.NamespaceSelector != "" {
+		return fmt.Sprintf("(namespaces matching %s)", args.NamespaceSelector)
+	}
+	return args.Namespace
+}
@@ -5,17 +5,22 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"runtime/debug"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
+	"syscall"
 	"time"
 
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -28,34 +33,115 @@ var Version = "dev"
 
 // Args holds the command line arguments for the application
 type Args struct {
-	PodName         string
-	DeploymentName  string
-	StatefulSetName string
-	Namespace       string
-	ContainerName   string
-	SearchPattern   string
-	TimeoutSecs     int
-	Debug           bool
-	Help            bool
-	ShowVersion     bool
-	KubeConfig      string
-	KubeContext     string
+	needle.Options
+	NeedleStdin           bool
+	NeedleFile            string
+	Timeout               time.Duration
+	TimeoutSecs           int
+	DeadlineStr           string
+	Deadline              time.Time
+	ContextLines          int
+	SinceStr              string
+	Tail                  int64
+	Verbosity             int
+	Quiet                 bool
+	Help                  bool
+	ShowVersion           bool
+	ShowContext           bool
+	CheckAccess           bool
+	KubeConfig            string
+	KubeContext           string
+	ImpersonateUser       string
+	ImpersonateGroups     []string
+	Token                 string
+	Server                string
+	InsecureSkipTLSVerify bool
+	QPS                   float32
+	Burst                 int
+	RequestTimeout        time.Duration
+	Compress              bool
+	Color                 string
+	Progress              string
+	Heartbeat             time.Duration
+	NoHints               bool
+	TUI                   bool
+	DryRun                bool
+	Output                string
+	Template              string
+	MetricsAddr           string
+	HealthAddr            string
+	OutputFile            string
+	WebhookURL            string
+	OnFound               string
+	OnFoundFatal          bool
+	SlackWebhook          string
+	Interval              time.Duration
+	ExitFound             int
+	ExitNotFound          int
+	ExitError             int
+	ExitInvert            int
 }
 
-// ResourceType represents the type of Kubernetes resource
-type ResourceType string
+// stringSliceFlag is a flag.Value collecting every occurrence of a repeatable flag
+type stringSliceFlag []string
 
-// Constants for resource types
-const (
-	ResourceTypeDeployment  ResourceType = "deployment"
-	ResourceTypeStatefulSet ResourceType = "statefulset"
-)
+// String returns the collected values joined by commas
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+// Set appends a value each time the flag is given
+func (s *stringSliceFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// targetFlag is a flag.Value for a repeatable pod or resource name: the first name sets the
+// option of a single pod or resource, and every name is collected as one of several targets
+type targetFlag struct {
+	resourceType needle.ResourceType
+	name         *string
+	targets      *[]needle.Target
+}
+
+// String returns the first name
+func (f targetFlag) String() string {
+	if f.name == nil {
+		return ""
+	}
+	return *f.name
+}
 
-// PodSearchResult stores the result of searching a single pod
-type PodSearchResult struct {
-	PodName string
-	Found   bool
-	Error   error
+// Set records another pod or resource name
+func (f targetFlag) Set(value string) error {
+	if *f.name == "" {
+		*f.name = value
+	}
+	*f.targets = append(*f.targets, needle.Target{Type: f.resourceType, Name: value})
+	return nil
+}
+
+// secondsOrDuration is a flag.Value for a duration given as a Go duration like 5m or, for
+// compatibility, a bare number of seconds
+type secondsOrDuration time.Duration
+
+// String returns the duration in Go syntax
+func (d *secondsOrDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+// Set parses a number of seconds or a Go duration
+func (d *secondsOrDuration) Set(value string) error {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		*d = secondsOrDuration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("expected a number of seconds or a duration like 5m or 1h30m")
+	}
+	*d = secondsOrDuration(duration)
+	return nil
 }
 
 func main() {
@@ -74,6 +160,21 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Show the cluster the search would run against if requested
+	if args.ShowContext {
+		if err := writeKubeContext(os.Stdout, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Resolve the search patterns from the flags or stdin
+	if err := resolveSearchPatterns(&args, os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Validate required arguments
 	if err := validateArgs(args); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -81,64 +182,298 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create Kubernetes client
-	clientset, err := createK8sClient(args)
+	// -context-lines sets the context on both sides unless given explicitly
+	if args.ContextLines > 0 {
+		if args.BeforeLines == 0 {
+			args.BeforeLines = args.ContextLines
+		}
+		if args.AfterLines == 0 {
+			args.AfterLines = args.ContextLines
+		}
+	}
+
+	// Apply the validated log history bounds
+	if args.SinceStr != "" {
+		args.Since, _ = time.ParseDuration(args.SinceStr)
+	}
+
+	// An absolute deadline replaces the timeout, which still bounds the preflight requests
+	if args.DeadlineStr != "" {
+		args.Deadline, _ = time.Parse(time.RFC3339, args.DeadlineStr)
+		args.Timeout = time.Until(args.Deadline)
+		args.TimeoutSecs = int(math.Ceil(args.Timeout.Seconds()))
+	}
+	if args.Tail >= 0 {
+		args.TailLines = &args.Tail
+	}
+
+	// Messages go through these writers so that -quiet can silence them
+	stdout, stderr := messageOutputs(args)
+
+	// Compile regular expressions before making any Kubernetes calls
+	if err := args.Compile(); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if hint := regexHint(args); hint != "" && !args.NoHints {
+		fmt.Fprintf(stderr, "Hint: %s\n", hint)
+	}
+
+	// Create Kubernetes clients
+	clientset, streamClientset, err := createK8sClients(args)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating Kubernetes client: %v\n", err)
+		fmt.Fprintf(stderr, "Error creating Kubernetes client: %v\n", err)
 		os.Exit(1)
 	}
+	searcher := needle.NewSearcher(clientset)
+	searcher.StreamClient = streamClientset
+	searcher.Verbosity = needle.Verbosity(args.Verbosity)
+	searcher.Stderr = stderr
+	searcher.Color = useColor(args.Color, infoOutput(args))
+
+	// Report missing RBAC permissions before discovery fails with a bare Forbidden
+	if args.CheckAccess {
+		ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
+		err := searcher.CheckAccess(ctx, args.Options)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(searchExitCode(args, needle.Result{}, err))
+		}
+	}
 
-	// Set up context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(args.TimeoutSecs)*time.Second)
-	defer cancel()
+	// List the pods that would be searched instead of searching them
+	if args.DryRun {
+		ctx, cancel := context.WithTimeout(context.Background(), args.Timeout)
+		defer cancel()
+		if err := runDryRun(ctx, searcher, args, stdout); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(searchExitCode(args, needle.Result{}, err))
+		}
+		os.Exit(0)
+	}
 
-	// Search for the pattern in pod logs
-	found, err := searchPodLogs(ctx, clientset, args)
+	// The TUI runs until the user quits rather than until the timeout
+	if args.TUI {
+		if err := runTUI(context.Background(), searcher, args); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(args.ExitError)
+		}
+		os.Exit(0)
+	}
+
+	// SIGINT and SIGTERM end the search
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Serve the metrics and health endpoints until the search, or the daemon, ends
+	if args.MetricsAddr != "" {
+		searcher.Metrics = needle.NewMetrics()
+	}
+	serverCtx, stopServers := context.WithCancel(signalCtx)
+	defer stopServers()
+	serversDone, err := startServers(serverCtx, args, searcher.Metrics)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(2)
+		fmt.Fprintf(stderr, "Error starting HTTP server: %v\n", err)
+		os.Exit(args.ExitError)
+	}
+	searcher.Stdout = infoOutput(args)
+
+	// Append the matched lines to the output file; failing to write them doesn't change the outcome
+	closeMatchFile := func() {}
+	if args.OutputFile != "" {
+		file, err := openMatchFile(args.OutputFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			os.Exit(args.ExitError)
+		}
+		searcher.MatchOutput = file
+		closeMatchFile = func() {
+			if err := file.Close(); err != nil {
+				fmt.Fprintf(stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+
+	// In daemon mode the search repeats until the process is signaled
+	if args.Interval > 0 {
+		runDaemon(signalCtx, searcher, args, stdout, stderr)
+		stopServers()
+		<-serversDone
+		closeMatchFile()
+		os.Exit(0)
+	}
+
+	// Redraw a status line per pod instead of scrolling the per-pod messages
+	var progress *progressDisplay
+	if useProgress(args) {
+		progress = newProgressDisplay(searcher.Stdout)
+		searcher.Progress = progress.update
+		searcher.Stdout = progress.writer(searcher.Stdout)
+		searcher.Stderr = progress.writer(searcher.Stderr)
+	}
+
+	// Set up context with timeout, or with the absolute deadline
+	deadline := time.Now().Add(args.Timeout)
+	if !args.Deadline.IsZero() {
+		deadline = args.Deadline
 	}
+	ctx, cancel := context.WithDeadline(signalCtx, deadline)
+	defer cancel()
 
-	if found {
-		if args.PodName != "" {
-			fmt.Printf("Success: Found pattern '%s' in logs of pod %s\n", args.SearchPattern, args.PodName)
+	// Show that a long search is still running
+	stopHeartbeat := func() {}
+	if useHeartbeat(args) {
+		beat := newHeartbeat(searcher.Stderr)
+		if progress := searcher.Progress; progress != nil {
+			searcher.Progress = func(namespace, podName string, status needle.PodStatus) {
+				progress(namespace, podName, status)
+				beat.update(namespace, podName, status)
+			}
 		} else {
-			var resourceType ResourceType
-			var resourceName string
+			searcher.Progress = beat.update
+		}
+		heartbeatCtx, cancelHeartbeat := context.WithCancel(ctx)
+		heartbeatDone := make(chan struct{})
+		go func() {
+			beat.run(heartbeatCtx, args.Heartbeat)
+			close(heartbeatDone)
+		}()
+		stopHeartbeat = func() {
+			cancelHeartbeat()
+			<-heartbeatDone
+		}
+	}
+
+	// Search for the pattern in pod logs
+	start := time.Now()
+	result, err := searcher.Search(ctx, args.Options)
+	stopHeartbeat()
+	if progress != nil {
+		progress.stop()
+	}
+	stopServers()
+	<-serversDone
+	closeMatchFile()
+
+	// A signal ends the search without an outcome
+	if signalCtx.Err() != nil {
+		fmt.Fprintf(stderr, "Interrupted: search of %s stopped by a signal\n", describeTarget(args))
+		os.Exit(130)
+	}
 
-			if args.DeploymentName != "" {
-				resourceType = ResourceTypeDeployment
-				resourceName = args.DeploymentName
+	// Notify the webhooks of a match without letting them change the outcome
+	if err == nil && result.Found {
+		notifyMatch(stderr, args, result, time.Since(start))
+	}
+
+	// Run the -on-found command, whose failure only fails the search with -on-found-fatal
+	if err == nil && result.Found && !args.Invert && args.OnFound != "" {
+		if hookErr := runOnFound(signalCtx, args, result, infoOutput(args), stderr); hookErr != nil {
+			if args.OnFoundFatal {
+				err = hookErr
 			} else {
-				resourceType = ResourceTypeStatefulSet
-				resourceName = args.StatefulSetName
+				fmt.Fprintf(stderr, "Warning: %v\n", hookErr)
 			}
+		}
+	}
 
-			fmt.Printf("Success: Found pattern '%s' in logs of all active pods in %s %s\n",
-				args.SearchPattern, resourceType, resourceName)
+	// Report the outcome as JSON instead of prose
+	if args.Output == outputJSON {
+		exitCode := searchExitCode(args, result, err)
+		if writeErr := writeJSONReport(os.Stdout, args, result, err, time.Since(start), exitCode); writeErr != nil {
+			fmt.Fprintf(stderr, "Error writing JSON output: %v\n", writeErr)
 		}
-		os.Exit(0)
+		os.Exit(exitCode)
+	}
+
+	// Or with the user's template
+	if args.Output == outputTemplate {
+		exitCode := searchExitCode(args, result, err)
+		if writeErr := writeTemplateReport(os.Stdout, args, result, err, time.Since(start), exitCode); writeErr != nil {
+			fmt.Fprintf(stderr, "Error writing template output: %v\n", writeErr)
+		}
+		os.Exit(exitCode)
+	}
+
+	// Summarize the pod outcomes of a resource search before its result
+	if !singlePod(args) && len(result.Pods) > 0 && searcher.Verbosity >= needle.VerbosityDiscovery {
+		writeSummary(stdout, args, result, time.Since(start))
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		// Resource searches print diagnostics per errored pod as results arrive
+		if singlePod(args) && len(result.Pods) == 1 && result.Pods[0].Diagnostic != nil {
+			needle.WriteDiagnostic(stderr, args.PodName, result.Pods[0].Diagnostic)
+		}
+		os.Exit(searchExitCode(args, result, err))
+	}
+
+	// Streamed matches end with the timeout or the logs, found if any line matched
+	if args.StreamMatches {
+		lines, matchedPods := 0, 0
+		for _, pod := range result.Pods {
+			lines += pod.Matches
+			if pod.Found {
+				matchedPods++
+			}
+		}
+		fmt.Fprintf(stdout, "Matched %d lines of pattern %s in %d of %d pods of %s\n",
+			lines, describePatterns(args), matchedPods, len(result.Pods), describeTarget(args))
+		os.Exit(searchExitCode(args, result, nil))
+	}
+
+	// In invert mode the pattern must stay absent for the whole timeout
+	if args.Invert {
+		if result.Found {
+			fmt.Fprintf(stderr, "Failure: Found pattern %s in logs of %s\n", describePatterns(args), describeTarget(args))
+			os.Exit(searchExitCode(args, result, nil))
+		}
+		fmt.Fprintf(stdout, "Success: Pattern %s not found in logs of %s within %s\n",
+			describePatterns(args), describeTarget(args), describeTimeout(args))
+		os.Exit(searchExitCode(args, result, nil))
+	}
+
+	if result.Found {
+		if singlePod(args) {
+			podName := args.PodName
+			if first, ok := result.FirstMatch(); ok {
+				podName = matchSource(args, first)
+			}
+			fmt.Fprintf(stdout, "Success: Found pattern %s in logs of pod %s\n", describePatterns(args), podName)
+		} else {
+			if args.ScanFull || args.Require == needle.RequireAny {
+				fmt.Fprintf(stdout, "Success: Found pattern %s in logs of at least one pod in %s\n",
+					describePatterns(args), describeTarget(args))
+			} else {
+				fmt.Fprintf(stdout, "Success: Found pattern %s in logs of all active pods in %s\n",
+					describePatterns(args), describeTarget(args))
+			}
+			if first, ok := result.FirstMatch(); ok {
+				fmt.Fprintf(stdout, "First match in pod %s at line %d: %s\n", matchSource(args, first), first.LineNumber, first.MatchedLine)
+			}
+		}
+		os.Exit(args.ExitFound)
 	} else {
 		// Timeout or pattern not found
-		if args.PodName != "" {
-			fmt.Fprintf(os.Stderr, "Timeout: Pattern '%s' not found in logs of pod %s within %d seconds\n",
-				args.SearchPattern, args.PodName, args.TimeoutSecs)
+		if args.Previous {
+			fmt.Fprintf(stderr, "Not found: Pattern %s not found in previous logs of %s\n", describePatterns(args), describeTarget(args))
+		} else if args.NoFollow {
+			fmt.Fprintf(stderr, "Not found: Pattern %s not found in available logs of %s\n", describePatterns(args), describeTarget(args))
+		} else if singlePod(args) {
+			fmt.Fprintf(stderr, "Timeout: Pattern %s not found in logs of pod %s within %s\n",
+				describePatterns(args), args.PodName, describeTimeout(args))
 		} else {
-			var resourceType ResourceType
-			var resourceName string
-
-			if args.DeploymentName != "" {
-				resourceType = ResourceTypeDeployment
-				resourceName = args.DeploymentName
+			if args.ScanFull || args.Require == needle.RequireAny {
+				fmt.Fprintf(stderr, "Timeout: Pattern %s not found in logs of any pod in %s within %s\n",
+					describePatterns(args), describeTarget(args), describeTimeout(args))
 			} else {
-				resourceType = ResourceTypeStatefulSet
-				resourceName = args.StatefulSetName
+				fmt.Fprintf(stderr, "Timeout: Pattern %s not found in logs of all active pods in %s within %s\n",
+					describePatterns(args), describeTarget(args), describeTimeout(args))
 			}
-
-			fmt.Fprintf(os.Stderr, "Timeout: Pattern '%s' not found in logs of all active pods in %s %s within %d seconds\n",
-				args.SearchPattern, resourceType, resourceName, args.TimeoutSecs)
 		}
-		os.Exit(3)
+		os.Exit(args.ExitNotFound)
 	}
 }
 
@@ -152,20 +487,113 @@ func parseArgs() Args {
 		defaultKubeconfig = filepath.Join(home, ".kube", "config")
 	}
 
-	flag.StringVar(&args.PodName, "pod", "", "Pod name (required if deployment and statefulset not specified)")
-	flag.StringVar(&args.DeploymentName, "deployment", "", "Deployment name (required if pod and statefulset not specified)")
-	flag.StringVar(&args.StatefulSetName, "statefulset", "", "StatefulSet name (required if pod and deployment not specified)")
+	flag.Var(targetFlag{needle.ResourceTypePod, &args.PodName, &args.Targets}, "pod", "Pod `name`, or a glob like web-* searching every matching pod, repeatable with the other resource flags to search several together (required if no other resource is specified)")
+	flag.Var(targetFlag{needle.ResourceTypeDeployment, &args.DeploymentName, &args.Targets}, "deployment", "Deployment `name`, repeatable (required if no other resource is specified)")
+	flag.Var(targetFlag{needle.ResourceTypeStatefulSet, &args.StatefulSetName, &args.Targets}, "statefulset", "StatefulSet `name`, repeatable (required if no other resource is specified)")
+	flag.Var(targetFlag{needle.ResourceTypeDaemonSet, &args.DaemonSetName, &args.Targets}, "daemonset", "DaemonSet `name`, repeatable (required if no other resource is specified)")
+	flag.Var(targetFlag{needle.ResourceTypeJob, &args.JobName, &args.Targets}, "job", "Job `name`, searching running and completed pods, repeatable (required if no other resource is specified)")
+	flag.Var(targetFlag{needle.ResourceTypeCronJob, &args.CronJobName, &args.Targets}, "cronjob", "CronJob `name`, searching its most recent Job, repeatable (required if no other resource is specified)")
+	flag.Var(targetFlag{needle.ResourceTypeDeploymentConfig, &args.DeploymentConfigName, &args.Targets}, "deploymentconfig", "OpenShift DeploymentConfig `name`, searching the pods of its latest running version, repeatable (required if no other resource is specified)")
+	flag.StringVar(&args.LabelSelector, "selector", "", "Label selector of the pods to search, e.g. app=foo,tier=web (required if no other resource is specified)")
+	flag.StringVar(&args.FieldSelector, "field-selector", "", "Field selector narrowing the pods of the resource or selector at the API server, e.g. status.phase=Running (optional)")
 	flag.StringVar(&args.Namespace, "namespace", "default", "Kubernetes namespace")
-	flag.StringVar(&args.ContainerName, "container", "", "Container name (optional if pod has only one container)")
-	flag.StringVar(&args.SearchPattern, "needle", "", "Search string/pattern to look for in logs (required)")
-	flag.IntVar(&args.TimeoutSecs, "timeout", 60, "Timeout in seconds (optional)")
-	flag.BoolVar(&args.Debug, "debug", false, "Enable debug mode to print logs")
+	require := flag.String("require", string(needle.RequireAll), "For deployments and other resources: 'all' (every pod must match) or 'any' (one pod matching is enough)")
+	flag.BoolVar(&args.StrictPods, "strict-pods", false, "Fail when a selected pod of the resource isn't running instead of skipping it (not for -pod)")
+	flag.BoolVar(&args.IncludeTerminating, "include-terminating", false, "Also search pods that are being deleted, until their logs end, instead of skipping them")
+	flag.BoolVar(&args.IncludeNotRunning, "include-not-running", false, "Also search the available logs of pods that aren't running, e.g. Failed or Pending, instead of skipping them")
+	flag.BoolVar(&args.LenientOwner, "lenient-owner", false, "Search the pods matching a deployment's selector when it owns no ReplicaSet, instead of failing")
+	flag.BoolVar(&args.WatchPods, "watch-pods", false, "Also search pods of the resource that start running during the search (not for -pod)")
+	flag.BoolVar(&args.AllNamespaces, "all-namespaces", false, "Look up the pod or the selector's pods in all namespaces (-pod and -selector only)")
+	flag.StringVar(&args.NamespaceSelector, "namespace-selector", "", "Search the resource or selector in every namespace with matching labels, e.g. team=payments (optional)")
+	flag.StringVar(&args.ContainerName, "container", "", "Container name, or comma-separated names to search several containers (optional if pod has only one container)")
+	flag.BoolVar(&args.DefaultFirstContainer, "default-first-container", false, "Search the first container of pods with several containers when -container is not set, instead of failing")
+	flag.BoolVar(&args.AllContainers, "all-containers", false, "Search every container of the pod, matching if any of them matches")
+	flag.BoolVar(&args.InitContainers, "init-containers", false, "Also search the logs of the pod's init containers")
+	flag.Var((*stringSliceFlag)(&args.SearchPatterns), "needle", "Search string/pattern to look for in logs, repeatable; '-' reads a single pattern from stdin (required unless -needle-stdin or -needle-file is set)")
+	flag.BoolVar(&args.NeedleStdin, "needle-stdin", false, "Read search patterns from stdin, one per line")
+	flag.StringVar(&args.NeedleFile, "needle-file", "", "Read search patterns from a file, one per line (blank lines and lines starting with '#' are ignored)")
+	matchMode := flag.String("match-mode", string(needle.MatchModeAny), "How multiple needles combine: 'any' (one of them) or 'all' (every one, possibly on different lines)")
+	flag.BoolVar(&args.Regex, "regex", false, "Treat the needle as a Go regular expression instead of a literal string")
+	flag.BoolVar(&args.WholeLine, "whole-line", false, "Require the whole line, without surrounding whitespace, to equal the needle (or fully match it with -regex)")
+	flag.BoolVar(&args.NoHints, "no-hints", false, "Don't print hints about likely mistakes, such as a literal needle that looks like a regular expression")
+	flag.BoolVar(&args.Multiline, "multiline", false, "Match the needle against a window of recent lines instead of each line, so a -regex can span lines")
+	flag.IntVar(&args.MultilineWindow, "multiline-window", 0, "Maximum size in bytes of the -multiline window (optional, defaults to 65536)")
+	stream := flag.String("stream", string(needle.StreamBoth), "Only search lines written to 'stdout' or 'stderr', or 'both', going by the stream field of JSON log lines")
+	flag.BoolVar(&args.JSONFields, "json-fields", false, "Treat the needle as conditions on the fields of JSON log lines, e.g. 'level=error,msg~timeout' (= equals, ~ contains)")
+	flag.IntVar(&args.Count, "count", 1, "Number of times the needle must appear before it counts as found")
+	countScope := flag.String("count-scope", string(needle.CountScopePod), "Where -count is reached for deployments and other resources: 'pod' (in every pod) or 'total' (across all pods)")
+	flag.StringVar(&args.Color, "color", colorAuto, "Highlight matches in the lines printed by -show-match and -debug: 'auto' (when stdout is a terminal), 'always' or 'never'")
+	flag.DurationVar(&args.Heartbeat, "heartbeat", 0, "Print a 'still searching' line on stderr at this interval while the search runs, e.g. 30s (optional)")
+	flag.StringVar(&args.Progress, "progress", colorAuto, "Keep a live status line per pod of a resource instead of scrolling messages: 'auto' (when stdout is a terminal), 'always' or 'never'")
+	flag.BoolVar(&args.ShowMatch, "show-match", false, "Print each matching line with its line number (and the matched text in regex mode)")
+	flag.BoolVar(&args.Dedup, "dedup", false, "Collapse runs of identical lines printed by -show-match or -debug into one line with a repeat count")
+	flag.IntVar(&args.BeforeLines, "before", 0, "Print this many lines of context before each match shown by -show-match")
+	flag.IntVar(&args.AfterLines, "after", 0, "Print this many lines of context after each match shown by -show-match")
+	flag.IntVar(&args.ContextLines, "context-lines", 0, "Print this many lines of context before and after each match shown by -show-match")
+	args.Timeout = 60 * time.Second
+	flag.Var((*secondsOrDuration)(&args.Timeout), "timeout", "Timeout as a `duration` like 90s or 5m, or a number of seconds (optional)")
+	flag.StringVar(&args.DeadlineStr, "deadline", "", "RFC3339 time by which the search ends, e.g. 2025-01-02T15:04:05Z, instead of -timeout (optional)")
+	flag.IntVar(&args.Verbosity, "v", int(needle.VerbosityMatches), "Verbosity: 0 only the result, 1 adds pod discovery, 2 adds match events, 3 adds every log line")
+	flag.BoolVar(&args.Quiet, "quiet", false, "Print nothing and report the result only through the exit code")
+	flag.BoolVar(&args.Debug, "debug", false, "Enable debug mode to print logs (same as -v 3)")
 	flag.StringVar(&args.KubeConfig, "kubeconfig", defaultKubeconfig, "Path to kubeconfig file (optional, defaults to ~/.kube/config)")
+	flag.StringVar(&args.Server, "server", "", "Kubernetes API server URL, used with -token instead of the in-cluster configuration or kubeconfig (optional)")
+	flag.StringVar(&args.Token, "token", "", "Bearer token for the API server given with -server (optional)")
+	flag.BoolVar(&args.InsecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Don't verify the API server's certificate (insecure)")
+	qps := flag.Float64("qps", float64(rest.DefaultQPS), "Maximum queries per second to the Kubernetes API server")
+	flag.IntVar(&args.Burst, "burst", rest.DefaultBurst, "Maximum burst of queries to the Kubernetes API server above -qps")
+	flag.DurationVar(&args.RequestTimeout, "request-timeout", 0, "Timeout of each Kubernetes API request other than log streams, e.g. 10s (optional, disabled by default)")
+	flag.BoolVar(&args.Compress, "compress", false, "Request gzip-compressed log streams and decompress them, saving bandwidth where the API server compresses them")
+	flag.StringVar(&args.ImpersonateUser, "as", "", "Username to impersonate for the Kubernetes API calls (optional)")
+	flag.Var((*stringSliceFlag)(&args.ImpersonateGroups), "as-group", "Group to impersonate for the Kubernetes API calls, repeatable (optional)")
 	flag.StringVar(&args.KubeContext, "context", "", "Kubernetes context to use (optional)")
+	flag.BoolVar(&args.DiagnoseOnError, "diagnose-on-error", false, "Print pod status diagnostics for pods whose search fails (adds API calls)")
+	flag.DurationVar(&args.PodTimeout, "pod-timeout", 0, "Stop searching each pod after this long, counting it as not found, e.g. 2m (optional, defaults to -timeout)")
+	flag.DurationVar(&args.ReadTimeout, "read-timeout", 0, "Reopen a pod's log stream after this long without output, e.g. 30s (optional, disabled by default)")
+	flag.IntVar(&args.MaxRetries, "max-retries", 3, "Retry a pod discovery API call failing with a transient error (timeout, 429 or 5xx) at most this many times, with exponential backoff")
+	flag.IntVar(&args.MaxReconnects, "max-reconnects", 5, "Reopen a pod's log stream at most this many times when it drops while the container keeps running")
+	flag.BoolVar(&args.SearchPreviousOnRestart, "search-previous-on-restart", false, "When the container restarted before the search, also search the logs of its previous instance first")
+	flag.BoolVar(&args.ResetOnRestart, "reset-on-restart", false, "When the container restarts during the search, restart the search on the new instance's logs")
+	flag.BoolVar(&args.Invert, "invert", false, "Succeed if the pattern does NOT appear within the timeout; fail (exit code 4) as soon as it does")
+	flag.IntVar(&args.Concurrency, "concurrency", 10, "Maximum number of pods of a resource searched at once, 0 for no limit")
+	flag.BoolVar(&args.KeepGoing, "keep-going", false, "With -require all, keep searching the other pods after one failed or ended without a match, to report every failure (not for -pod)")
+	flag.BoolVar(&args.ScanFull, "scan-full", false, "Search the whole timeout window instead of stopping early, then report every pod that matched (not for -pod)")
+	flag.BoolVar(&args.OrderedOutput, "ordered-output", false, "Print the messages of each pod grouped together, in discovery order, when the search ends instead of interleaving them live (not for -pod)")
+	flag.BoolVar(&args.StreamMatches, "stream-matches", false, "Print every matching line, prefixed by its pod, until the timeout instead of stopping at the first match, then report how many were seen")
+	flag.StringVar(&args.SinceStr, "since", "", "Only search logs newer than this duration, e.g. 5m (optional, defaults to all logs)")
+	flag.Int64Var(&args.Tail, "tail", -1, "Only search this many of the most recent log lines before following, -1 for all (optional)")
+	flag.IntVar(&args.MaxLogLines, "max-log-lines", 0, "Stop reading a pod's log stream after this many lines without a match, counting it as not found, 0 for no limit (optional)")
+	flag.Int64Var(&args.LimitBytes, "limit-bytes", 0, "Stop reading a pod's logs after this many bytes, counting it as not found, 0 for no limit (optional)")
+	flag.BoolVar(&args.FromStart, "from-start", false, "Read the logs from the pod's creation, including lines logged before the search connected (add -timestamps to see how far back they go)")
+	flag.BoolVar(&args.TailThenFollow, "tail-then-follow", false, "Read the -tail or -since history to its end, marking where it ends, before following new lines")
+	flag.BoolVar(&args.WaitForReady, "wait-ready", false, "Wait, within the timeout, for the container to be ready before reading its logs instead of failing when it hasn't started")
+	flag.BoolVar(&args.NoFollow, "no-follow", false, "Only search the logs available now and exit at their end instead of waiting for new lines")
+	flag.BoolVar(&args.Timestamps, "timestamps", false, "Prefix every log line with its Kubernetes RFC3339 timestamp")
+	flag.DurationVar(&args.Within, "within", 0, "Only count matches on lines logged at most this long ago, e.g. 30s; lines without a timestamp don't count (requires -timestamps)")
+	flag.BoolVar(&args.MatchTimestamps, "match-timestamps", false, "Test the needle against the timestamp-prefixed line instead of the line without it (requires -timestamps)")
+	flag.BoolVar(&args.Previous, "previous", false, "Search the logs of the last terminated instance of the container instead of following the current one")
+	flag.IntVar(&args.ExitFound, "exit-found", 0, "Exit code when the pattern is found, or with -invert when it stays absent")
+	flag.IntVar(&args.ExitNotFound, "exit-notfound", 3, "Exit code when the pattern is not found before the timeout")
+	flag.IntVar(&args.ExitError, "exit-error", 2, "Exit code when the search fails (a missing pod or resource always exits with 5)")
+	flag.IntVar(&args.ExitInvert, "exit-invert", 4, "Exit code when the pattern appears with -invert")
+	flag.StringVar(&args.Output, "output", outputText, "Output format: 'text', 'json' (a single JSON document on stdout, progress on stderr) or 'template' (see -template)")
+	flag.StringVar(&args.Template, "template", "", "Go text/template rendering the outcome with -output template, e.g. '{{.Pod}} {{.MatchedLine}}'")
+	flag.StringVar(&args.OutputFile, "output-file", "", "Append every matching line, prefixed with the time, namespace, pod and container, to this file (optional)")
+	flag.StringVar(&args.WebhookURL, "webhook-url", "", "POST a JSON notification with the matching pods to this URL when the pattern is found (optional)")
+	flag.StringVar(&args.SlackWebhook, "slack-webhook", "", "Post a Slack message to this incoming-webhook URL when the pattern is found (optional)")
+	flag.StringVar(&args.OnFound, "on-found", "", "Shell command run when the pattern is found, with KLOGS_POD, KLOGS_NAMESPACE, KLOGS_MATCH, KLOGS_PODS and KLOGS_TARGET set (optional)")
+	flag.BoolVar(&args.OnFoundFatal, "on-found-fatal", false, "Exit with the error code when the -on-found command fails instead of warning")
+	flag.DurationVar(&args.Interval, "interval", 0, "Repeat the search at this interval until signaled, printing a line whenever the pattern appears or disappears, e.g. 1m (optional)")
+	flag.StringVar(&args.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on /metrics at this address during the search, e.g. :9090 (optional)")
+	flag.StringVar(&args.HealthAddr, "health-addr", "", "Serve a /healthz liveness endpoint at this address while searching, e.g. :8081 (optional)")
+	flag.BoolVar(&args.CheckAccess, "check-access", false, "Check the RBAC permissions the search needs with SelfSubjectAccessReviews before searching (optional)")
+	flag.BoolVar(&args.DryRun, "dry-run", false, "List the pods that would be searched, and why others are skipped, then exit without reading logs")
+	flag.BoolVar(&args.TUI, "tui", false, "Interactively explore pods and their matches (requires a build with -tags tui)")
+	flag.BoolVar(&args.ShowContext, "show-context", false, "Print the Kubernetes context, API server and namespaces a search would use, then exit")
+	config := flag.String("config", "", "YAML file setting defaults for any flag, keyed by flag name (optional, defaults to ~/"+defaultConfigFile+" if it exists)")
 	help := flag.Bool("help", false, "Show help")
 	h := flag.Bool("h", false, "Show help")
 	version := flag.Bool("version", false, "Show version information")
-	v := flag.Bool("v", false, "Show version information")
 
 	// Define custom usage message
 	flag.Usage = func() {
@@ -177,549 +605,661 @@ func parseArgs() Args {
 		fmt.Fprintf(os.Stderr, "  %s -pod my-pod -namespace my-namespace -needle \"Service started\" -timeout 60\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -deployment my-deployment -namespace my-namespace -needle \"Service started\" -timeout 60\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -statefulset my-statefulset -namespace my-namespace -needle \"Service started\" -timeout 60\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -daemonset my-daemonset -namespace my-namespace -needle \"Service started\" -timeout 60\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s -pod my-pod -kubeconfig /path/to/kubeconfig -context my-context -needle \"Service started\"\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nEvery option not given on the command line can be set from a %s* environment variable,\n", envPrefix)
+		fmt.Fprintf(os.Stderr, "e.g. %s for -pod-timeout.\n", envName("pod-timeout"))
 	}
 
 	flag.Parse()
 
+	// Flags left unset on the command line take their value from KLOGS_* environment variables,
+	// then from the config file, if any
+	if err := applyEnv(flag.CommandLine, os.LookupEnv); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	configPath, explicitConfig := *config, *config != ""
+	if !explicitConfig && homedir.HomeDir() != "" {
+		configPath = filepath.Join(homedir.HomeDir(), defaultConfigFile)
+	}
+	if configPath != "" {
+		if err := applyConfigFile(flag.CommandLine, configPath, explicitConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Check for help flag
 	args.Help = *help || *h
 
 	// Check for version flag
-	args.ShowVersion = *version || *v
+	args.ShowVersion = *version
+
+	args.MatchMode = needle.MatchMode(*matchMode)
+	args.Stream = needle.LogStream(*stream)
+	args.CountScope = needle.CountScope(*countScope)
+	args.Require = needle.Requirement(*require)
+	args.QPS = float32(*qps)
+	args.TimeoutSecs = int(math.Ceil(args.Timeout.Seconds()))
+	// A single pod or resource keeps its own option; several are searched together as targets
+	if len(args.Targets) > 1 {
+		args.PodName, args.DeploymentName, args.StatefulSetName = "", "", ""
+		args.DaemonSetName, args.JobName, args.CronJobName, args.DeploymentConfigName = "", "", "", ""
+	} else {
+		args.Targets = nil
+	}
+	// Several comma-separated containers are searched concurrently
+	if strings.Contains(args.ContainerName, ",") {
+		for _, name := range strings.Split(args.ContainerName, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				args.Containers = append(args.Containers, name)
+			}
+		}
+		args.ContainerName = ""
+	}
+	if args.Debug {
+		args.Verbosity = int(needle.VerbosityLogs)
+	}
 
 	return args
 }
 
 // Validate required arguments
 func validateArgs(args Args) error {
-	// Skip validation if showing version or help
-	if args.ShowVersion || args.Help {
+	// Skip validation if showing version, help or the context
+	if args.ShowVersion || args.Help || args.ShowContext {
 		return nil
 	}
 
-	// Check if at least one resource type is specified
-	if args.PodName == "" && args.DeploymentName == "" && args.StatefulSetName == "" {
-		return fmt.Errorf("either pod name, deployment name, or statefulset name is required")
-	}
-
-	// Check that only one resource type is specified
+	// Check that exactly one resource type is specified
 	specifiedCount := 0
-	if args.PodName != "" {
-		specifiedCount++
-	}
-	if args.DeploymentName != "" {
-		specifiedCount++
+	for _, name := range []string{args.PodName, args.DeploymentName, args.StatefulSetName, args.DaemonSetName, args.JobName, args.CronJobName, args.DeploymentConfigName, args.LabelSelector} {
+		if name != "" {
+			specifiedCount++
+		}
 	}
-	if args.StatefulSetName != "" {
+
+	if len(args.Targets) > 0 {
 		specifiedCount++
 	}
 
+	if specifiedCount == 0 {
+		return fmt.Errorf("either a pod name, a deployment, statefulset, daemonset, job, cronjob or deploymentconfig name, or a label selector is required")
+	}
 	if specifiedCount > 1 {
-		return fmt.Errorf("cannot specify more than one of: pod name, deployment name, statefulset name")
+		return fmt.Errorf("cannot combine a label selector with pod or resource names")
+	}
+	if args.Require != needle.RequireAll && args.Require != needle.RequireAny {
+		return fmt.Errorf("require must be '%s' or '%s'", needle.RequireAll, needle.RequireAny)
+	}
+	if args.StrictPods && singlePod(args) {
+		return fmt.Errorf("-strict-pods requires a resource other than a single pod")
+	}
+	if args.IncludeNotRunning && args.StrictPods {
+		return fmt.Errorf("cannot combine -include-not-running with -strict-pods")
+	}
+	if args.LenientOwner && args.DeploymentName == "" {
+		return fmt.Errorf("-lenient-owner requires -deployment")
+	}
+	if args.WatchPods && (singlePod(args) || len(args.Targets) > 0) {
+		return fmt.Errorf("-watch-pods requires a single resource other than a pod")
+	}
+	if args.AllNamespaces && args.PodName == "" && args.LabelSelector == "" {
+		return fmt.Errorf("-all-namespaces requires -pod or -selector")
+	}
+	if args.NamespaceSelector != "" {
+		if args.PodName != "" || len(args.Targets) > 0 {
+			return fmt.Errorf("-namespace-selector requires a single resource other than a pod")
+		}
+		if args.AllNamespaces || args.WatchPods {
+			return fmt.Errorf("cannot combine -namespace-selector with -all-namespaces or -watch-pods")
+		}
+		if _, err := labels.Parse(args.NamespaceSelector); err != nil {
+			return fmt.Errorf("invalid namespace selector '%s': %v", args.NamespaceSelector, err)
+		}
+	}
+	if args.LabelSelector != "" {
+		if _, err := labels.Parse(args.LabelSelector); err != nil {
+			return fmt.Errorf("invalid label selector '%s': %v", args.LabelSelector, err)
+		}
+	}
+	if args.FieldSelector != "" {
+		if singlePod(args) {
+			return fmt.Errorf("-field-selector requires a resource other than a single pod")
+		}
+		if _, err := fields.ParseSelector(args.FieldSelector); err != nil {
+			return fmt.Errorf("invalid field selector '%s': %v", args.FieldSelector, err)
+		}
 	}
 
 	// Validate other required arguments
-	if args.SearchPattern == "" {
+	if len(args.SearchPatterns) == 0 && !args.DryRun {
 		return fmt.Errorf("search pattern (needle) is required")
 	}
-	if args.TimeoutSecs <= 0 {
-		return fmt.Errorf("timeout must be a positive number of seconds")
+	if args.MatchMode != needle.MatchModeAny && args.MatchMode != needle.MatchModeAll {
+		return fmt.Errorf("match mode must be '%s' or '%s'", needle.MatchModeAny, needle.MatchModeAll)
+	}
+	if args.Stream != needle.StreamBoth && args.Stream != needle.StreamStdout && args.Stream != needle.StreamStderr {
+		return fmt.Errorf("stream must be '%s', '%s' or '%s'", needle.StreamStdout, needle.StreamStderr, needle.StreamBoth)
+	}
+	if args.Regex && args.JSONFields {
+		return fmt.Errorf("cannot combine -regex with -json-fields")
+	}
+	if args.MultilineWindow < 0 {
+		return fmt.Errorf("multiline window must not be negative")
+	}
+	if args.MultilineWindow > 0 && !args.Multiline {
+		return fmt.Errorf("-multiline-window requires -multiline")
+	}
+	if args.Multiline && (args.JSONFields || args.TUI) {
+		return fmt.Errorf("cannot combine -multiline with -json-fields or -tui")
+	}
+	if args.WholeLine && (args.JSONFields || args.Multiline) {
+		return fmt.Errorf("cannot combine -whole-line with -json-fields or -multiline")
+	}
+	if args.Count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	if args.CountScope != needle.CountScopePod && args.CountScope != needle.CountScopeTotal {
+		return fmt.Errorf("count scope must be '%s' or '%s'", needle.CountScopePod, needle.CountScopeTotal)
+	}
+	if args.CountScope == needle.CountScopeTotal && args.ScanFull {
+		return fmt.Errorf("cannot combine -count-scope %s with -scan-full", needle.CountScopeTotal)
+	}
+	if args.Timeout <= 0 {
+		return fmt.Errorf("timeout must be a positive duration or number of seconds")
+	}
+	if args.Invert && args.ScanFull {
+		return fmt.Errorf("cannot combine -invert with -scan-full")
+	}
+	if args.KeepGoing && (args.Require != needle.RequireAll || args.Invert || args.ScanFull || args.StreamMatches) {
+		return fmt.Errorf("-keep-going requires -require all and cannot be combined with -invert, -scan-full or -stream-matches")
+	}
+	if args.KeepGoing && singlePod(args) {
+		return fmt.Errorf("-keep-going requires a resource other than a single pod")
+	}
+	if args.OrderedOutput && singlePod(args) {
+		return fmt.Errorf("-ordered-output requires a resource other than a single pod")
+	}
+	if args.ScanFull && singlePod(args) {
+		return fmt.Errorf("-scan-full requires a resource other than a single pod")
+	}
+	if args.StreamMatches && (args.Invert || args.ScanFull || args.ShowMatch || args.Count > 1 || args.MatchMode == needle.MatchModeAll) {
+		return fmt.Errorf("cannot combine -stream-matches with -invert, -scan-full, -show-match, -count or -match-mode all")
+	}
+	if args.StreamMatches && (args.TUI || args.Interval > 0) {
+		return fmt.Errorf("cannot combine -stream-matches with -tui or -interval")
+	}
+	if args.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	if args.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative")
+	}
+	if args.MaxReconnects < 0 {
+		return fmt.Errorf("max reconnects must not be negative")
+	}
+	if args.PodTimeout < 0 {
+		return fmt.Errorf("pod timeout must not be negative")
+	}
+	if args.ReadTimeout < 0 {
+		return fmt.Errorf("read timeout must not be negative")
+	}
+	if args.DeadlineStr != "" {
+		deadline, err := time.Parse(time.RFC3339, args.DeadlineStr)
+		if err != nil {
+			return fmt.Errorf("invalid -deadline '%s': expected an RFC3339 time like 2025-01-02T15:04:05Z", args.DeadlineStr)
+		}
+		if !deadline.After(time.Now()) {
+			return fmt.Errorf("-deadline %s is not in the future", args.DeadlineStr)
+		}
+		if args.Interval > 0 {
+			return fmt.Errorf("cannot combine -deadline with -interval")
+		}
+	}
+	if args.SinceStr != "" {
+		since, err := time.ParseDuration(args.SinceStr)
+		if err != nil {
+			return fmt.Errorf("invalid -since duration '%s': %v", args.SinceStr, err)
+		}
+		if since <= 0 {
+			return fmt.Errorf("-since must be a positive duration")
+		}
+	}
+	if args.AllContainers && (args.ContainerName != "" || len(args.Containers) > 0) {
+		return fmt.Errorf("cannot combine -all-containers with -container")
+	}
+	if args.DefaultFirstContainer && (args.ContainerName != "" || len(args.Containers) > 0 || args.AllContainers) {
+		return fmt.Errorf("cannot combine -default-first-container with -container or -all-containers")
+	}
+	if (args.AllContainers || args.InitContainers || len(args.Containers) > 0) && args.TUI {
+		return fmt.Errorf("-all-containers, -init-containers and several -container names are not supported in TUI mode")
+	}
+	if args.BeforeLines < 0 || args.AfterLines < 0 || args.ContextLines < 0 {
+		return fmt.Errorf("context line counts must not be negative")
+	}
+	if (args.BeforeLines > 0 || args.AfterLines > 0 || args.ContextLines > 0) && !args.ShowMatch {
+		return fmt.Errorf("-before, -after and -context-lines require -show-match")
+	}
+	if args.Dedup && (args.BeforeLines > 0 || args.AfterLines > 0 || args.ContextLines > 0) {
+		return fmt.Errorf("cannot combine -dedup with -before, -after or -context-lines")
+	}
+	if args.MatchTimestamps && !args.Timestamps {
+		return fmt.Errorf("-match-timestamps requires -timestamps")
+	}
+	if args.Within < 0 {
+		return fmt.Errorf("within must not be negative")
+	}
+	if args.Within > 0 && !args.Timestamps {
+		return fmt.Errorf("-within requires -timestamps")
+	}
+	if args.NoFollow && args.ReadTimeout > 0 {
+		return fmt.Errorf("cannot combine -no-follow with -read-timeout")
+	}
+	if args.Previous && args.ResetOnRestart {
+		return fmt.Errorf("cannot combine -previous with -reset-on-restart")
+	}
+	if args.SearchPreviousOnRestart && (args.Previous || args.ResetOnRestart) {
+		return fmt.Errorf("cannot combine -search-previous-on-restart with -previous or -reset-on-restart")
+	}
+	if args.Tail < -1 {
+		return fmt.Errorf("-tail must be a non-negative number of lines")
+	}
+	if args.WaitForReady && args.Previous {
+		return fmt.Errorf("cannot combine -wait-ready with -previous")
+	}
+	if args.FromStart && (args.Tail >= 0 || args.SinceStr != "") {
+		return fmt.Errorf("cannot combine -from-start with -tail or -since")
+	}
+	if args.TailThenFollow && args.Tail < 0 && args.SinceStr == "" {
+		return fmt.Errorf("-tail-then-follow requires -tail or -since")
+	}
+	if args.TailThenFollow && (args.NoFollow || args.Previous) {
+		return fmt.Errorf("cannot combine -tail-then-follow with -no-follow or -previous")
+	}
+	if args.MaxLogLines < 0 {
+		return fmt.Errorf("-max-log-lines must not be negative")
+	}
+	if args.LimitBytes < 0 {
+		return fmt.Errorf("-limit-bytes must not be negative")
+	}
+	for _, code := range []int{args.ExitFound, args.ExitNotFound, args.ExitError, args.ExitInvert} {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("exit codes must be between 0 and 255")
+		}
+	}
+	if args.Color != colorAuto && args.Color != colorAlways && args.Color != colorNever {
+		return fmt.Errorf("color must be '%s', '%s' or '%s'", colorAuto, colorAlways, colorNever)
+	}
+	if args.Progress != colorAuto && args.Progress != colorAlways && args.Progress != colorNever {
+		return fmt.Errorf("progress must be '%s', '%s' or '%s'", colorAuto, colorAlways, colorNever)
+	}
+	if args.Output != outputText && args.Output != outputJSON && args.Output != outputTemplate {
+		return fmt.Errorf("output format must be '%s', '%s' or '%s'", outputText, outputJSON, outputTemplate)
+	}
+	if (args.Output == outputTemplate) != (args.Template != "") {
+		return fmt.Errorf("-output %s and -template must be used together", outputTemplate)
+	}
+	if args.Template != "" {
+		if _, err := parseOutputTemplate(args.Template); err != nil {
+			return err
+		}
+	}
+	if reportOutput(args) && args.TUI {
+		return fmt.Errorf("cannot combine -output %s with -tui", args.Output)
+	}
+	if args.WatchPods && args.TUI {
+		return fmt.Errorf("cannot combine -watch-pods with -tui")
+	}
+	// The TUI matches each line on its own, without the search's counting, stream limits or outcome
+	if args.TUI && (args.Count > 1 || args.Within > 0 || args.MatchMode == needle.MatchModeAll || args.ReadTimeout > 0 || args.MaxLogLines > 0 || args.LimitBytes > 0 ||
+		args.Invert || args.ScanFull || args.Require == needle.RequireAny || args.CountScope == needle.CountScopeTotal) {
+		return fmt.Errorf("cannot combine -tui with -count, -within, -match-mode all, -read-timeout, -max-log-lines, -limit-bytes, -invert, -scan-full, -require any or -count-scope total")
+	}
+	for _, webhook := range []string{args.WebhookURL, args.SlackWebhook} {
+		if webhook == "" {
+			continue
+		}
+		webhookURL, err := url.Parse(webhook)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			return fmt.Errorf("webhook URLs must be http or https URLs")
+		}
+	}
+	if args.OnFoundFatal && args.OnFound == "" {
+		return fmt.Errorf("-on-found-fatal requires -on-found")
+	}
+	if args.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	if args.Heartbeat < 0 {
+		return fmt.Errorf("heartbeat must not be negative")
+	}
+	if args.Interval > 0 && (args.TUI || args.Invert || reportOutput(args)) {
+		return fmt.Errorf("cannot combine -interval with -tui, -invert or -output %s or %s", outputJSON, outputTemplate)
+	}
+	if args.DryRun && (args.TUI || args.Interval > 0 || reportOutput(args)) {
+		return fmt.Errorf("cannot combine -dry-run with -tui, -interval or -output %s or %s", outputJSON, outputTemplate)
+	}
+	if args.OutputFile != "" && args.TUI {
+		return fmt.Errorf("cannot combine -output-file with -tui")
+	}
+	if (args.MetricsAddr != "" || args.HealthAddr != "") && args.TUI {
+		return fmt.Errorf("cannot combine -metrics-addr or -health-addr with -tui")
+	}
+	if args.Verbosity < int(needle.VerbosityQuiet) || args.Verbosity > int(needle.VerbosityLogs) {
+		return fmt.Errorf("verbosity must be between %d and %d", needle.VerbosityQuiet, needle.VerbosityLogs)
+	}
+	if args.Quiet && (args.TUI || reportOutput(args)) {
+		return fmt.Errorf("cannot combine -quiet with -tui or -output %s or %s", outputJSON, outputTemplate)
+	}
+	if args.QPS <= 0 || args.Burst < 1 {
+		return fmt.Errorf("-qps must be positive and -burst at least 1")
+	}
+	if args.RequestTimeout < 0 {
+		return fmt.Errorf("request timeout must not be negative")
+	}
+	if (args.Token == "") != (args.Server == "") {
+		return fmt.Errorf("-token and -server must be given together")
+	}
+	if len(args.ImpersonateGroups) > 0 && args.ImpersonateUser == "" {
+		return fmt.Errorf("-as-group requires -as")
+	}
+	if args.TUI && !tuiAvailable {
+		return fmt.Errorf("TUI support is not compiled in, rebuild with -tags tui")
 	}
 	return nil
 }
 
-// Create Kubernetes client using in-cluster or out-of-cluster configuration
-func createK8sClient(args Args) (*kubernetes.Clientset, error) {
-	var config *rest.Config
-	var err error
-
-	// Try in-cluster config first
-	config, err = rest.InClusterConfig()
-	if err != nil {
-		// If in-cluster config fails, try using kubeconfig file
-		fmt.Println("Not running inside a Kubernetes cluster, using local kubeconfig")
-
-		// Check if kubeconfig file exists
-		if _, err := os.Stat(args.KubeConfig); os.IsNotExist(err) {
-			return nil, fmt.Errorf("kubeconfig file not found at %s: %v", args.KubeConfig, err)
-		}
-
-		// Load kubeconfig
-		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: args.KubeConfig}
-		configOverrides := &clientcmd.ConfigOverrides{}
+// Read the search patterns from -needle-file, from stdin with -needle-stdin, or from stdin for a '-' needle
+func resolveSearchPatterns(args *Args, stdin io.Reader) error {
+	stdinNeedle := slices.Index(args.SearchPatterns, "-")
+	if args.NeedleStdin && (len(args.SearchPatterns) > 0 || args.NeedleFile != "") {
+		return fmt.Errorf("cannot combine -needle-stdin with -needle or -needle-file")
+	}
+	if stdinNeedle >= 0 && slices.Index(args.SearchPatterns[stdinNeedle+1:], "-") >= 0 {
+		return fmt.Errorf("-needle - can only be given once")
+	}
 
-		// Set context if provided
-		if args.KubeContext != "" {
-			configOverrides.CurrentContext = args.KubeContext
+	if args.NeedleFile != "" {
+		patterns, err := readPatternFile(args.NeedleFile)
+		if err != nil {
+			return err
 		}
+		args.SearchPatterns = append(args.SearchPatterns, patterns...)
+	}
 
-		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-		config, err = kubeConfig.ClientConfig()
+	if stdinNeedle >= 0 {
+		pattern, err := readStdinPattern(stdin)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
+			return err
 		}
-	} else {
-		fmt.Println("Running inside a Kubernetes cluster, using in-cluster configuration")
+		args.SearchPatterns[stdinNeedle] = pattern
 	}
 
-	// Create clientset
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	if !args.NeedleStdin {
+		return nil
 	}
 
-	return clientset, nil
-}
+	if err := requirePipedStdin(stdin, "-needle-stdin"); err != nil {
+		return err
+	}
 
-// Search for pattern in pod logs
-func searchPodLogs(ctx context.Context, clientset *kubernetes.Clientset, args Args) (bool, error) {
-	if args.PodName != "" {
-		// Search in a single pod
-		return searchSinglePodLogs(ctx, clientset, args.PodName, args)
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		pattern := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		args.SearchPatterns = append(args.SearchPatterns, pattern)
 	}
-	if args.DeploymentName != "" {
-		// Search in all pods of a deployment
-		return searchResourcePodLogs(ctx, clientset, ResourceTypeDeployment, args.DeploymentName, args)
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read search patterns from stdin: %v", err)
 	}
-	// Search in all pods of a statefulset
-	return searchResourcePodLogs(ctx, clientset, ResourceTypeStatefulSet, args.StatefulSetName, args)
-}
 
-// Search for pattern in logs of all pods in a resource (deployment or statefulset)
-func searchResourcePodLogs(ctx context.Context, clientset *kubernetes.Clientset, resourceType ResourceType, resourceName string, args Args) (bool, error) {
-	// Get pods from the resource
-	var pods []corev1.Pod
-	var err error
-
-	switch resourceType {
-	case ResourceTypeDeployment:
-		pods, err = getPodsFromDeployment(ctx, clientset, resourceName, args.Namespace)
-	case ResourceTypeStatefulSet:
-		pods, err = getPodsFromStatefulSet(ctx, clientset, resourceName, args.Namespace)
-	default:
-		return false, fmt.Errorf("unsupported resource type: %s", resourceType)
+	if len(args.SearchPatterns) == 0 {
+		return fmt.Errorf("no search patterns read from stdin (input was empty)")
 	}
+	return nil
+}
 
+// Read search patterns from a file, one per line, skipping blank lines and '#' comments
+func readPatternFile(path string) ([]string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return false, err
-	}
-
-	fmt.Printf("Found %d pods for %s '%s'\n", len(pods), resourceType, resourceName)
-
-	// Create a wait group to wait for all goroutines
-	var wg sync.WaitGroup
-	// Create a mutex for synchronizing access to shared resources
-	var mu sync.Mutex
-	// Create a channel to receive results
-	resultChan := make(chan PodSearchResult, len(pods))
-	// Create a channel to signal early termination
-	doneChan := make(chan struct{})
-	// Use atomic counters for thread safety
-	var successCount int32
-	var errorCount int32
-	podCount := len(pods)
-
-	// Create a context that will be canceled when the first pod finds the pattern or on timeout
-	searchCtx, cancelSearch := context.WithCancel(ctx)
-	defer cancelSearch() // Ensure context is canceled when we exit
-
-	// Start a goroutine for each pod
-	for _, pod := range pods {
-		wg.Add(1)
-		go func(pod corev1.Pod) {
-			// Ensure WaitGroup is decremented even if panic occurs
-			defer func() {
-				if r := recover(); r != nil {
-					mu.Lock()
-					fmt.Fprintf(os.Stderr, "Panic in goroutine for pod '%s': %v\n%s\n",
-						pod.Name, r, debug.Stack())
-					mu.Unlock()
-
-					// Send error result to channel
-					select {
-					case resultChan <- PodSearchResult{
-						PodName: pod.Name,
-						Found:   false,
-						Error:   fmt.Errorf("panic occurred: %v", r),
-					}:
-					case <-searchCtx.Done():
-						// Context was canceled, don't send to channel
-					}
-				}
-				wg.Done()
-			}()
-
-			// Create a timeout specific to this goroutine
-			podCtx, podCancel := context.WithTimeout(searchCtx, time.Duration(args.TimeoutSecs)*time.Second)
-			defer podCancel() // Ensure the context is canceled when goroutine exits
-
-			// Create args for this pod
-			podArgs := args
-			podArgs.PodName = pod.Name
-
-			// Search for pattern in this pod
-			found, err := searchSinglePodLogs(podCtx, clientset, pod.Name, podArgs)
-
-			// Check if context was canceled before sending result
-			select {
-			case <-searchCtx.Done():
-				// Context was canceled, don't send to channel
-				return
-			default:
-				// Send result to channel
-				resultChan <- PodSearchResult{
-					PodName: pod.Name,
-					Found:   found,
-					Error:   err,
-				}
-
-				// If pattern was found, cancel the context to stop other goroutines
-				if found && atomic.AddInt32(&successCount, 1) == int32(podCount) {
-					// All pods have found the pattern, signal early termination
-					select {
-					case doneChan <- struct{}{}:
-					default:
-						// Channel already has a value, no need to send again
-					}
-					cancelSearch()
-				}
-			}
-		}(pod)
-	}
-
-	// Close the result channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(resultChan)
-		close(doneChan)
-	}()
-
-	// Process results
-	for {
-		select {
-		case <-ctx.Done():
-			// Parent context was canceled (timeout)
-			return false, nil
-
-		case <-doneChan:
-			// All pods have found the pattern
-			return true, nil
-
-		case result, ok := <-resultChan:
-			if !ok {
-				// Channel closed, all goroutines are done
-				// Check final counts
-				finalSuccessCount := atomic.LoadInt32(&successCount)
-				finalErrorCount := atomic.LoadInt32(&errorCount)
-
-				if finalSuccessCount == int32(podCount) {
-					return true, nil
-				}
-
-				if finalErrorCount > 0 {
-					return false, fmt.Errorf("failed to search logs in %d out of %d pods",
-						finalErrorCount, podCount)
-				}
-
-				return false, nil
-			}
-
-			// Process the result
-			if result.Error != nil {
-				mu.Lock()
-				fmt.Fprintf(os.Stderr, "Error searching pod '%s': %v\n", result.PodName, result.Error)
-				mu.Unlock()
-				atomic.AddInt32(&errorCount, 1)
-			} else if result.Found {
-				// Success count is incremented in the goroutine when found
-			}
+		return nil, fmt.Errorf("failed to open needle file: %v", err)
+	}
+	defer file.Close()
 
-			// Check if we're done due to errors or success
-			totalProcessed := atomic.LoadInt32(&errorCount) + atomic.LoadInt32(&successCount)
-			if totalProcessed == int32(podCount) {
-				// All pods have been processed
-				if atomic.LoadInt32(&errorCount) > 0 {
-					// Some pods had errors
-					return false, fmt.Errorf("failed to search logs in %d out of %d pods",
-						atomic.LoadInt32(&errorCount), podCount)
-				}
-
-				// All pods were processed successfully
-				if atomic.LoadInt32(&successCount) == int32(podCount) {
-					// All pods found the pattern
-					return true, nil
-				}
-
-				// Some pods didn't find the pattern (but had no errors)
-				return false, nil
-			}
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		pattern := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(pattern) == "" || strings.HasPrefix(strings.TrimSpace(pattern), "#") {
+			continue
 		}
+		patterns = append(patterns, pattern)
 	}
-}
-
-// Get pods from a deployment
-func getPodsFromDeployment(ctx context.Context, clientset *kubernetes.Clientset, deploymentName, namespace string) ([]corev1.Pod, error) {
-	// Get the deployment
-	deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to find deployment '%s' in namespace '%s': %v", deploymentName, namespace, err)
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read needle file '%s': %v", path, err)
 	}
 
-	// Explicitly use appsv1 type to avoid unused import
-	var _ appsv1.Deployment = appsv1.Deployment{}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no search patterns found in needle file '%s'", path)
+	}
+	return patterns, nil
+}
 
-	// Get the selector from the deployment
-	selector := deployment.Spec.Selector
-	labelSelector := labels.SelectorFromSet(selector.MatchLabels)
+// Read the single pattern given as '-needle -' from stdin
+func readStdinPattern(stdin io.Reader) (string, error) {
+	if err := requirePipedStdin(stdin, "-needle -"); err != nil {
+		return "", err
+	}
 
-	// List pods with the selector
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector.String(),
-	})
+	data, err := io.ReadAll(stdin)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pods for deployment '%s': %v", deploymentName, err)
+		return "", fmt.Errorf("failed to read search pattern from stdin: %v", err)
+	}
+	pattern := strings.TrimRight(string(data), "\r\n")
+	if strings.TrimSpace(pattern) == "" {
+		return "", fmt.Errorf("no search pattern read from stdin (input was empty)")
 	}
+	if strings.Contains(pattern, "\n") {
+		return "", fmt.Errorf("-needle - reads a single pattern; use -needle-stdin for one pattern per line")
+	}
+	return pattern, nil
+}
 
-	// Get the ReplicaSet that's currently owned by the deployment
-	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector.String(),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list ReplicaSets for deployment '%s': %v", deploymentName, err)
-	}
-
-	// Find the active ReplicaSet (the one with the most replicas)
-	var activeReplicaSet *appsv1.ReplicaSet
-	for i := range replicaSets.Items {
-		rs := &replicaSets.Items[i]
-		// Check if this ReplicaSet is owned by our deployment
-		for _, owner := range rs.OwnerReferences {
-			if owner.Kind == "Deployment" && owner.Name == deploymentName {
-				if activeReplicaSet == nil || *rs.Spec.Replicas > *activeReplicaSet.Spec.Replicas {
-					activeReplicaSet = rs
-				}
-				break
-			}
+// Refuse to block on an interactive terminal waiting for patterns
+func requirePipedStdin(stdin io.Reader, flagName string) error {
+	if file, ok := stdin.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return fmt.Errorf("%s requires patterns to be piped on stdin", flagName)
 		}
 	}
+	return nil
+}
 
-	if activeReplicaSet == nil {
-		return nil, fmt.Errorf("no active ReplicaSet found for deployment '%s'", deploymentName)
-	}
+// Signs that a literal needle was meant as a regular expression: a repeated dot, a character class
+// escape or range, an anchor or an alternation
+var regexLikeNeedle = regexp.MustCompile(`\.[*+?]|\\[dwsbDWS]|\[[^\]]+-[^\]]+\]|^\^|\$$|\|`)
 
-	// Filter pods to only include those from the active ReplicaSet and not terminating
-	activePods := []corev1.Pod{}
-	for _, pod := range pods.Items {
-		// Skip pods that are being deleted
-		if pod.DeletionTimestamp != nil {
-			fmt.Printf("Skipping terminating pod '%s' (has deletion timestamp)\n", pod.Name)
-			continue
+// Suggest -regex for the first literal needle that looks like a regular expression
+func regexHint(args Args) string {
+	if args.Regex || args.JSONFields {
+		return ""
+	}
+	for _, pattern := range args.SearchPatterns {
+		if regexLikeNeedle.MatchString(pattern) {
+			return fmt.Sprintf("needle '%s' looks like a regular expression but is matched literally; add -regex to match it as one (-no-hints hides this)", pattern)
 		}
+	}
+	return ""
+}
 
-		// Skip pods that are not in Running phase
-		if pod.Status.Phase != corev1.PodRunning {
-			fmt.Printf("Skipping non-running pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
-			continue
-		}
+// Name the pod of a match, as pod/container when several containers of each pod are searched
+func matchSource(args Args, pod needle.PodSearchResult) string {
+	if pod.Container != "" && (args.AllContainers || args.InitContainers || len(args.Containers) > 0) {
+		return pod.PodName + "/" + pod.Container
+	}
+	return pod.PodName
+}
 
-		// Check if this pod is owned by the active ReplicaSet
-		isOwnedByActiveRS := false
-		for _, owner := range pod.OwnerReferences {
-			if owner.Kind == "ReplicaSet" && owner.Name == activeReplicaSet.Name {
-				isOwnedByActiveRS = true
-				break
-			}
-		}
+// Check whether a single pod is searched, named by -pod rather than matched by a pattern
+func singlePod(args Args) bool {
+	return args.PodName != "" && !needle.IsPodPattern(args.PodName)
+}
 
-		if !isOwnedByActiveRS {
-			fmt.Printf("Skipping pod '%s' (not owned by the active ReplicaSet '%s')\n", pod.Name, activeReplicaSet.Name)
-			continue
-		}
+// Check whether the searched pods may live in several namespaces, so they are named with theirs
+func spansNamespaces(args Args) bool {
+	return args.AllNamespaces || args.NamespaceSelector != ""
+}
 
-		activePods = append(activePods, pod)
+// Describe the search patterns for user-facing messages
+func describePatterns(args Args) string {
+	var description string
+	if len(args.SearchPatterns) == 1 {
+		description = fmt.Sprintf("'%s'", args.SearchPatterns[0])
+	} else {
+		description = fmt.Sprintf("%s of '%s'", args.MatchMode, strings.Join(args.SearchPatterns, "', '"))
 	}
 
-	if len(activePods) == 0 {
-		return nil, fmt.Errorf("no active pods found for deployment '%s'", deploymentName)
+	switch {
+	case args.Count > 1 && args.CountScope == needle.CountScopeTotal && !singlePod(args):
+		description += fmt.Sprintf(" (%d times in total)", args.Count)
+	case args.Count > 1:
+		description += fmt.Sprintf(" (%d times)", args.Count)
 	}
+	return description
+}
 
-	fmt.Printf("Found %d active pods from ReplicaSet '%s' for deployment '%s'\n",
-		len(activePods), activeReplicaSet.Name, deploymentName)
-	return activePods, nil
+// Describe the searched pod or resource for user-facing messages
+func describeTarget(args Args) string {
+	if needle.IsPodPattern(args.PodName) {
+		return fmt.Sprintf("pods matching %s", args.PodName)
+	}
+	if args.PodName != "" {
+		return fmt.Sprintf("pod %s", args.PodName)
+	}
+	if len(args.Targets) > 0 {
+		descriptions := make([]string, len(args.Targets))
+		for i, target := range args.Targets {
+			descriptions[i] = fmt.Sprintf("%s %s", target.Type, target.Name)
+		}
+		last := len(descriptions) - 1
+		return strings.Join(descriptions[:last], ", ") + " and " + descriptions[last]
+	}
+	resourceType, resourceName := args.Resource()
+	return fmt.Sprintf("%s %s", resourceType, resourceName)
 }
 
-// Get pods from a statefulset
-func getPodsFromStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, statefulSetName, namespace string) ([]corev1.Pod, error) {
-	// Get the statefulset
-	statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, statefulSetName, metav1.GetOptions{})
+// Describe the search timeout in messages, in seconds when it is a whole number of them
+func describeTimeout(args Args) string {
+	if !args.Deadline.IsZero() {
+		return "the deadline " + args.Deadline.Format(time.RFC3339)
+	}
+	if args.Timeout%time.Second == 0 {
+		return fmt.Sprintf("%d seconds", int(args.Timeout/time.Second))
+	}
+	return args.Timeout.String()
+}
+
+// Create Kubernetes client using in-cluster or out-of-cluster configuration
+func createK8sClients(args Args) (*kubernetes.Clientset, *kubernetes.Clientset, error) {
+	config, err := buildRestConfig(args)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find statefulset '%s' in namespace '%s': %v", statefulSetName, namespace, err)
+		return nil, nil, err
 	}
 
-	// Get the selector from the statefulset
-	selector := statefulSet.Spec.Selector
-	labelSelector := labels.SelectorFromSet(selector.MatchLabels)
+	// Create clientset
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
+	}
 
-	// List pods with the selector
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labelSelector.String(),
-	})
+	// The request timeout would cut log streams and watches, which end with the search instead
+	if config.Timeout == 0 {
+		return clientset, clientset, nil
+	}
+	streamConfig := rest.CopyConfig(config)
+	streamConfig.Timeout = 0
+	streamClientset, err := kubernetes.NewForConfig(streamConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pods for statefulset '%s': %v", statefulSetName, err)
+		return nil, nil, fmt.Errorf("failed to create Kubernetes client: %v", err)
 	}
 
-	// Get the current revision and update revision from the StatefulSet status
-	currentRevision := statefulSet.Status.CurrentRevision
-	updateRevision := statefulSet.Status.UpdateRevision
+	return clientset, streamClientset, nil
+}
 
-	// If updateRevision is set and different from currentRevision, a rolling update is in progress
-	isRollingUpdate := updateRevision != "" && updateRevision != currentRevision
+// Build the REST config from the command line token and server, the in-cluster configuration
+// or the kubeconfig, in that order, applying the command line overrides
+func buildRestConfig(args Args) (*rest.Config, error) {
+	var config *rest.Config
+	var err error
 
-	if isRollingUpdate {
-		fmt.Printf("StatefulSet '%s' is undergoing a rolling update (current: %s, update: %s)\n",
-			statefulSetName, currentRevision, updateRevision)
+	// Report where the configuration comes from on stderr, along with the pod discovery messages
+	_, info := messageOutputs(args)
+	if args.Verbosity < int(needle.VerbosityDiscovery) {
+		info = io.Discard
 	}
 
-	// Filter out terminating pods and ensure they belong to the StatefulSet
-	activePods := []corev1.Pod{}
-	for _, pod := range pods.Items {
-		// Skip pods that are being deleted
-		if pod.DeletionTimestamp != nil {
-			fmt.Printf("Skipping terminating pod '%s' (has deletion timestamp)\n", pod.Name)
-			continue
-		}
+	// An explicit API server and token need no configuration file
+	if args.Token != "" && args.Server != "" {
+		fmt.Fprintf(info, "Using the API server %s with the given token\n", args.Server)
+		config = &rest.Config{Host: args.Server, BearerToken: args.Token}
+	} else if config, err = rest.InClusterConfig(); err != nil {
+		// If in-cluster config fails, try using kubeconfig file
+		fmt.Fprintln(info, "Not running inside a Kubernetes cluster, using local kubeconfig")
 
-		// Skip pods that are not in Running phase
-		if pod.Status.Phase != corev1.PodRunning {
-			fmt.Printf("Skipping non-running pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
-			continue
+		// Check if kubeconfig file exists
+		if _, err := os.Stat(args.KubeConfig); os.IsNotExist(err) {
+			return nil, fmt.Errorf("kubeconfig file not found at %s: %v", args.KubeConfig, err)
 		}
 
-		// Check if this pod is owned by the StatefulSet
-		isOwnedByStatefulSet := false
-		for _, owner := range pod.OwnerReferences {
-			if owner.Kind == "StatefulSet" && owner.Name == statefulSetName {
-				isOwnedByStatefulSet = true
-				break
-			}
-		}
+		// Load kubeconfig
+		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: args.KubeConfig}
+		configOverrides := &clientcmd.ConfigOverrides{}
 
-		if !isOwnedByStatefulSet {
-			fmt.Printf("Skipping pod '%s' (not owned by the StatefulSet '%s')\n", pod.Name, statefulSetName)
-			continue
+		// Set context if provided
+		if args.KubeContext != "" {
+			configOverrides.CurrentContext = args.KubeContext
 		}
 
-		// If a rolling update is in progress, check the pod's controller-revision-hash label
-		if isRollingUpdate {
-			// Get the controller-revision-hash label
-			revisionHash, ok := pod.Labels["controller-revision-hash"]
-			if !ok {
-				fmt.Printf("Skipping pod '%s' (missing controller-revision-hash label)\n", pod.Name)
-				continue
-			}
-
-			// During a rolling update, we want to include only pods with the update revision
-			if revisionHash != updateRevision {
-				fmt.Printf("Skipping pod '%s' (old revision: %s, target: %s)\n",
-					pod.Name, revisionHash, updateRevision)
-				continue
-			}
+		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+		config, err = kubeConfig.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
 		}
-
-		activePods = append(activePods, pod)
+	} else {
+		fmt.Fprintln(info, "Running inside a Kubernetes cluster, using in-cluster configuration")
 	}
 
-	if len(activePods) == 0 {
-		return nil, fmt.Errorf("no active pods found for statefulset '%s'", statefulSetName)
+	// Skip the server certificate check, which client-go refuses alongside a CA
+	if args.InsecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
 	}
 
-	fmt.Printf("Found %d active pods for StatefulSet '%s'\n", len(activePods), statefulSetName)
-	return activePods, nil
-}
+	// Client-side rate limits and the timeout of each non-streaming request
+	config.QPS = args.QPS
+	config.Burst = args.Burst
+	config.Timeout = args.RequestTimeout
 
-// Search for pattern in logs of a single pod
-func searchSinglePodLogs(ctx context.Context, clientset *kubernetes.Clientset, podName string, args Args) (bool, error) {
-	// Check if pod exists
-	pod, err := clientset.CoreV1().Pods(args.Namespace).Get(ctx, podName, metav1.GetOptions{})
-	if err != nil {
-		return false, fmt.Errorf("failed to find pod '%s' in namespace '%s': %v", podName, args.Namespace, err)
+	// Request gzip-compressed log streams
+	if args.Compress {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return gzipLogTransport{base: rt}
+		})
 	}
 
-	// Skip terminating pods
-	if pod.DeletionTimestamp != nil {
-		return false, fmt.Errorf("pod '%s' is being terminated (has deletion timestamp), skipping log search", podName)
-	}
-
-	if pod.Status.Phase != corev1.PodRunning {
-		return false, fmt.Errorf("pod '%s' is not running (phase: %s), skipping log search", podName, pod.Status.Phase)
-	}
-
-	// Validate container name if provided
-	if args.ContainerName != "" {
-		containerExists := false
-		for _, container := range pod.Spec.Containers {
-			if container.Name == args.ContainerName {
-				containerExists = true
-				break
-			}
-		}
-		if !containerExists {
-			return false, fmt.Errorf("container '%s' not found in pod '%s'", args.ContainerName, podName)
-		}
-	} else if len(pod.Spec.Containers) > 1 {
-		// If container name is not provided and pod has multiple containers
-		containerNames := []string{}
-		for _, container := range pod.Spec.Containers {
-			containerNames = append(containerNames, container.Name)
-		}
-		return false, fmt.Errorf("pod '%s' has multiple containers (%s), please specify a container name",
-			podName, strings.Join(containerNames, ", "))
+	// Run the search as another user, e.g. to check its RBAC permissions
+	if args.ImpersonateUser != "" {
+		config.Impersonate.UserName = args.ImpersonateUser
 	}
-
-	// Set up log options
-	podLogOptions := corev1.PodLogOptions{
-		Follow:    true,
-		Container: args.ContainerName,
+	if len(args.ImpersonateGroups) > 0 {
+		config.Impersonate.Groups = args.ImpersonateGroups
 	}
 
-	// Request logs
-	req := clientset.CoreV1().Pods(args.Namespace).GetLogs(podName, &podLogOptions)
-	podLogs, err := req.Stream(ctx)
-	if err != nil {
-		return false, fmt.Errorf("failed to open log stream for pod '%s': %v", podName, err)
-	}
-	defer podLogs.Close()
-
-	// Read logs line by line
-	reader := bufio.NewReader(podLogs)
-	for {
-		select {
-		case <-ctx.Done():
-			// Timeout reached
-			return false, nil
-		default:
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				// Check if context was canceled (timeout)
-				if ctx.Err() != nil {
-					return false, nil
-				}
-				return false, fmt.Errorf("error reading logs: %v", err)
-			}
-
-			// Print log line if debug is enabled
-			if args.Debug {
-				fmt.Printf("[%s] %s", podName, line)
-			}
-
-			// Check if line contains the search pattern
-			if strings.Contains(line, args.SearchPattern) {
-				if args.Debug || args.DeploymentName != "" || args.StatefulSetName != "" {
-					fmt.Printf("Found pattern '%s' in pod '%s'\n", args.SearchPattern, podName)
-				}
-				return true, nil
-			}
-		}
-	}
+	return config, nil
 }
@@ -0,0 +1,748 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Minimal kubeconfig pointing at a local API server
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: kubeconfig-token
+`
+
+// Write the test kubeconfig to a temporary file
+func writeTestKubeconfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestBuildRestConfigImpersonation(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	config, err := buildRestConfig(Args{
+		KubeConfig:        writeTestKubeconfig(t),
+		ImpersonateUser:   "jane",
+		ImpersonateGroups: []string{"developers", "auditors"},
+		Output:            outputJSON,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Impersonate.UserName != "jane" {
+		t.Errorf("impersonated user = %q, want %q", config.Impersonate.UserName, "jane")
+	}
+	if len(config.Impersonate.Groups) != 2 || config.Impersonate.Groups[1] != "auditors" {
+		t.Errorf("impersonated groups = %v, want [developers auditors]", config.Impersonate.Groups)
+	}
+}
+
+func TestBuildRestConfigTokenAndServer(t *testing.T) {
+	// An explicit server and token win over the kubeconfig
+	config, err := buildRestConfig(Args{
+		KubeConfig:            writeTestKubeconfig(t),
+		Server:                "https://api.example.com:6443",
+		Token:                 "pipeline-token",
+		InsecureSkipTLSVerify: true,
+		Output:                outputJSON,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Host != "https://api.example.com:6443" || config.BearerToken != "pipeline-token" {
+		t.Errorf("host = %q, token = %q, want the command line values", config.Host, config.BearerToken)
+	}
+	if !config.TLSClientConfig.Insecure {
+		t.Errorf("TLS verification is still enabled")
+	}
+}
+
+func TestSearchExitCode(t *testing.T) {
+	args := Args{ExitFound: 10, ExitNotFound: 11, ExitError: 12, ExitInvert: 13}
+	found := needle.Result{Found: true}
+	for _, tt := range []struct {
+		name   string
+		invert bool
+		result needle.Result
+		err    error
+		want   int
+	}{
+		{name: "found", result: found, want: 10},
+		{name: "not found", want: 11},
+		{name: "error", err: fmt.Errorf("connection refused"), want: 12},
+		{name: "missing resource", err: needle.ErrResourceNotFound, want: exitResourceMissing},
+		{name: "invert found", invert: true, result: found, want: 13},
+		{name: "invert absent", invert: true, want: 10},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args.Invert = tt.invert
+			if code := searchExitCode(args, tt.result, tt.err); code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchExitCodeMissingResource(t *testing.T) {
+	searcher := needle.NewSearcher(fake.NewClientset())
+	args := Args{ExitError: 2}
+	args.DeploymentName = "web"
+	args.Namespace = "default"
+	args.SearchPatterns = []string{"Service started"}
+
+	result, err := searcher.Search(context.Background(), args.Options)
+	if err == nil || err.Error() != "deployment 'web' not found in namespace 'default'" {
+		t.Fatalf("err = %v, want the missing deployment reported", err)
+	}
+	if code := searchExitCode(args, result, err); code != exitResourceMissing {
+		t.Errorf("exit code = %d, want %d", code, exitResourceMissing)
+	}
+	if code := searchExitCode(args, result, fmt.Errorf("connection refused")); code != args.ExitError {
+		t.Errorf("exit code = %d for another error, want %d", code, args.ExitError)
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *Args) {
+		args := &Args{}
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.StringVar(&args.Namespace, "namespace", "default", "")
+		flags.IntVar(&args.Concurrency, "concurrency", 10, "")
+		flags.BoolVar(&args.Debug, "debug", false, "")
+		flags.Var((*stringSliceFlag)(&args.SearchPatterns), "needle", "")
+		flags.String("config", "", "")
+		return flags, args
+	}
+	writeConfig := func(content string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		return path
+	}
+
+	flags, args := newFlags()
+	if err := flags.Parse([]string{"-concurrency", "5"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := writeConfig("namespace: staging\nconcurrency: 20\ndebug: true\nneedle:\n  - one\n  - two\n")
+	if err := applyConfigFile(flags, path, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args.Namespace != "staging" || args.Concurrency != 5 || !args.Debug || !reflect.DeepEqual(args.SearchPatterns, []string{"one", "two"}) {
+		t.Errorf("args = %+v, want the file's values under the command line's", *args)
+	}
+
+	for content, want := range map[string]string{
+		"namespce: staging\n":  "unknown key 'namespce'",
+		"config: other.yaml\n": "unknown key 'config'",
+		"concurrency: lots\n":  "invalid value for 'concurrency'",
+	} {
+		flags, _ := newFlags()
+		err := applyConfigFile(flags, writeConfig(content), true)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("config %q: err = %v, want %q", content, err, want)
+		}
+	}
+
+	// Only a config file named explicitly must exist
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if err := applyConfigFile(flag.NewFlagSet("test", flag.ContinueOnError), missing, false); err != nil {
+		t.Errorf("missing default config: unexpected error: %v", err)
+	}
+	if err := applyConfigFile(flag.NewFlagSet("test", flag.ContinueOnError), missing, true); err == nil {
+		t.Errorf("missing explicit config: expected an error")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	args := &Args{}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.StringVar(&args.Namespace, "namespace", "default", "")
+	flags.Var((*secondsOrDuration)(&args.Timeout), "timeout", "")
+	flags.IntVar(&args.Concurrency, "pod-concurrency", 10, "")
+	flags.Var((*stringSliceFlag)(&args.SearchPatterns), "needle", "")
+	if err := flags.Parse([]string{"-namespace", "cli"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := map[string]string{
+		"KLOGS_NAMESPACE":       "env",
+		"KLOGS_TIMEOUT":         "90s",
+		"KLOGS_POD_CONCURRENCY": "3",
+		"KLOGS_NEEDLE":          "Service started",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := applyEnv(flags, lookupEnv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args.Namespace != "cli" || args.Timeout != 90*time.Second || args.Concurrency != 3 || !reflect.DeepEqual(args.SearchPatterns, []string{"Service started"}) {
+		t.Errorf("args = %+v, want the environment's values under the command line's", *args)
+	}
+
+	env = map[string]string{"KLOGS_TIMEOUT": "soon"}
+	flags = flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(new(secondsOrDuration), "timeout", "")
+	err := applyEnv(flags, lookupEnv)
+	if err == nil || !strings.Contains(err.Error(), "KLOGS_TIMEOUT") {
+		t.Errorf("err = %v, want an invalid KLOGS_TIMEOUT error", err)
+	}
+}
+
+func TestWriteKubeContext(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	content := `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://dev.example.com:6443
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com:6443
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+- name: prod
+  context:
+    cluster: prod-cluster
+    namespace: payments
+`
+	if err := os.WriteFile(kubeconfig, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    Args
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "current context",
+			args: Args{KubeConfig: kubeconfig, Options: needle.Options{Namespace: "default"}},
+			want: []string{"Context            dev", "Server             https://dev.example.com:6443", "Default namespace  (not set)", "Search namespace   default"},
+		},
+		{
+			name: "explicit context",
+			args: Args{KubeConfig: kubeconfig, KubeContext: "prod", Options: needle.Options{AllNamespaces: true}},
+			want: []string{"Context            prod", "Server             https://prod.example.com:6443", "Default namespace  payments", "Search namespace   (all namespaces)"},
+		},
+		{
+			name:    "unknown context",
+			args:    Args{KubeConfig: kubeconfig, KubeContext: "staging"},
+			wantErr: "context 'staging' not found",
+		},
+		{
+			name: "token and server",
+			args: Args{KubeConfig: kubeconfig, Token: "secret", Server: "https://api.example.com", Options: needle.Options{Namespace: "ops"}},
+			want: []string{"Server             https://api.example.com", "Search namespace   ops"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := writeKubeContext(&out, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output %q doesn't contain %q", out.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestTargetFlag(t *testing.T) {
+	args := Args{}
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(targetFlag{needle.ResourceTypeDeployment, &args.DeploymentName, &args.Targets}, "deployment", "")
+	flags.Var(targetFlag{needle.ResourceTypeStatefulSet, &args.StatefulSetName, &args.Targets}, "statefulset", "")
+	if err := flags.Parse([]string{"-deployment", "web", "-statefulset", "db", "-deployment", "api"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []needle.Target{
+		{Type: needle.ResourceTypeDeployment, Name: "web"},
+		{Type: needle.ResourceTypeStatefulSet, Name: "db"},
+		{Type: needle.ResourceTypeDeployment, Name: "api"},
+	}
+	if !reflect.DeepEqual(args.Targets, want) {
+		t.Errorf("targets = %v, want %v", args.Targets, want)
+	}
+
+	args = Args{Options: needle.Options{Targets: want}}
+	if got := describeTarget(args); got != "deployment web, statefulset db and deployment api" {
+		t.Errorf("describeTarget = %q", got)
+	}
+	args.LabelSelector = "app=web"
+	if err := validateArgs(args); err == nil || !strings.Contains(err.Error(), "cannot combine a label selector") {
+		t.Errorf("err = %v, want an error combining a label selector with resource names", err)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	args := Args{Timeout: time.Minute, Color: colorAuto, Progress: colorAuto, Output: outputText}
+	args.DeploymentName = "web"
+	args.SearchPatterns = []string{"Service started"}
+	args.Require = needle.RequireAll
+	args.MatchMode = needle.MatchModeAny
+	args.Stream = needle.StreamBoth
+	args.CountScope = needle.CountScopePod
+	args.Count = 1
+	args.Tail = -1
+	args.ExitNotFound = 1
+	args.ExitError = 2
+	args.Verbosity = int(needle.VerbosityMatches)
+	args.QPS = 5
+	args.Burst = 10
+
+	for _, tt := range []struct {
+		deadline string
+		wantErr  string
+	}{
+		{deadline: time.Now().Add(time.Hour).Format(time.RFC3339)},
+		{deadline: time.Now().Add(-time.Hour).Format(time.RFC3339), wantErr: "is not in the future"},
+		{deadline: "tomorrow", wantErr: "expected an RFC3339 time"},
+	} {
+		args.DeadlineStr = tt.deadline
+		err := validateArgs(args)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("deadline %s: unexpected error: %v", tt.deadline, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("deadline %s: err = %v, want %q", tt.deadline, err, tt.wantErr)
+		}
+	}
+
+	args.Deadline = time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+	if got := describeTimeout(args); got != "the deadline 2030-01-02T15:04:05Z" {
+		t.Errorf("describeTimeout = %q", got)
+	}
+}
+
+func TestTUIRejectsSearchOnlyFlags(t *testing.T) {
+	for _, set := range []func(args *Args){
+		func(args *Args) { args.Count = 3 },
+		func(args *Args) { args.Timestamps, args.Within = true, time.Minute },
+		func(args *Args) { args.MatchMode = needle.MatchModeAll },
+		func(args *Args) { args.ReadTimeout = time.Minute },
+		func(args *Args) { args.Invert = true },
+		func(args *Args) { args.ScanFull = true },
+		func(args *Args) { args.Require = needle.RequireAny },
+		func(args *Args) { args.CountScope = needle.CountScopeTotal },
+	} {
+		args := Args{Timeout: time.Minute, Color: colorAuto, Progress: colorAuto, Output: outputText, TUI: true}
+		args.DeploymentName = "web"
+		args.SearchPatterns = []string{"Service started"}
+		args.Require = needle.RequireAll
+		args.MatchMode = needle.MatchModeAny
+		args.Stream = needle.StreamBoth
+		args.CountScope = needle.CountScopePod
+		args.Count = 1
+		args.Tail = -1
+		args.Verbosity = int(needle.VerbosityMatches)
+		args.QPS = 5
+		args.Burst = 10
+		set(&args)
+		if err := validateArgs(args); err == nil || !strings.Contains(err.Error(), "cannot combine -tui") {
+			t.Errorf("err = %v, want the flag rejected with -tui", err)
+		}
+	}
+}
+
+func TestSecondsOrDuration(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "90", want: 90 * time.Second},
+		{value: "90s", want: 90 * time.Second},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "0", want: 0},
+		{value: "five minutes", wantErr: true},
+	} {
+		var timeout time.Duration
+		err := (*secondsOrDuration)(&timeout).Set(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if timeout != tt.want {
+			t.Errorf("Set(%q) = %v, want %v", tt.value, timeout, tt.want)
+		}
+	}
+}
+
+func TestStartServersSharedAddress(t *testing.T) {
+	// Reserve a free port, then release it for the servers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done, err := startServers(ctx, Args{MetricsAddr: addr, HealthAddr: addr}, needle.NewMetrics())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for path, want := range map[string]string{"/healthz": "ok", "/metrics": "klogs_needle_searches_total"} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("GET %s = %d %q, want 200 containing %q", path, resp.StatusCode, body, want)
+		}
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("servers did not shut down after the context ended")
+	}
+}
+
+func TestRunDaemonReportsOnlyChanges(t *testing.T) {
+	// The fake clientset serves "fake logs" as every pod's logs, so every search misses
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	searcher := needle.NewSearcher(fake.NewClientset(pod))
+	searcher.Stdout = io.Discard
+	searcher.Stderr = io.Discard
+
+	args := Args{Interval: 10 * time.Millisecond, Timeout: 5 * time.Second}
+	args.PodName = "web"
+	args.Namespace = "default"
+	args.SearchPatterns = []string{"Service started"}
+	args.Count = 1
+	args.NoFollow = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var stdout, stderr strings.Builder
+	runDaemon(ctx, searcher, args, &stdout, &stderr)
+
+	if strings.Count(stdout.String(), "\n") != 1 || !strings.Contains(stdout.String(), "Not found: Pattern 'Service started' not found in logs of pod web") {
+		t.Errorf("stdout = %q, want a single not found line", stdout.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("stderr = %q, want empty", stderr.String())
+	}
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	var payload webhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	args := Args{}
+	args.DeploymentName = "web"
+	args.Namespace = "default"
+	args.SearchPatterns = []string{"Service started"}
+	result := needle.Result{Found: true, Pods: []needle.PodSearchResult{
+		{PodName: "web-a", Namespace: "default", Found: true, MatchedLine: "Service started on port 8080"},
+		{PodName: "web-b", Namespace: "default"},
+	}}
+
+	if err := notifyWebhook(server.URL, args, result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if payload.Resource == nil || *payload.Resource != (jsonResource{Type: "deployment", Name: "web", Namespace: "default"}) {
+		t.Errorf("resource = %+v", payload.Resource)
+	}
+	if len(payload.Matches) != 1 || payload.Matches[0].Pod != "web-a" || payload.Matches[0].MatchedLine != "Service started on port 8080" {
+		t.Errorf("matches = %+v, want only web-a with its matched line", payload.Matches)
+	}
+	if payload.Timestamp.IsZero() {
+		t.Errorf("timestamp not set")
+	}
+
+	// An unreachable webhook is reported as an error for the caller to warn about
+	server.Close()
+	if err := notifyWebhook(server.URL, args, result); err == nil {
+		t.Errorf("expected an error for an unreachable webhook")
+	}
+}
+
+func TestRunOnFound(t *testing.T) {
+	args := Args{}
+	args.DeploymentName = "web"
+	result := needle.Result{Found: true, Pods: []needle.PodSearchResult{
+		{PodName: "web-a", Namespace: "default"},
+		{PodName: "web-b", Namespace: "default", Found: true, MatchedLine: "Service started on port 8080"},
+		{PodName: "web-c", Namespace: "default", Found: true, MatchedLine: "Service started on port 8081"},
+	}}
+
+	args.OnFound = `echo "$KLOGS_POD|$KLOGS_NAMESPACE|$KLOGS_MATCH|$KLOGS_PODS|$KLOGS_TARGET"`
+	var out bytes.Buffer
+	if err := runOnFound(context.Background(), args, result, &out, io.Discard); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "web-b|default|Service started on port 8080|web-b web-c|deployment web\n"
+	if out.String() != want {
+		t.Errorf("hook output = %q, want %q", out.String(), want)
+	}
+
+	args.OnFound = "exit 3"
+	if err := runOnFound(context.Background(), args, result, io.Discard, io.Discard); err == nil {
+		t.Errorf("expected an error from a failing command")
+	}
+}
+
+func TestNotifySlack(t *testing.T) {
+	var message slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	args := Args{}
+	args.DeploymentName = "web"
+	args.Namespace = "default"
+	args.SearchPatterns = []string{"Service started"}
+	result := needle.Result{Found: true, Pods: []needle.PodSearchResult{{PodName: "web-a", Found: true}, {PodName: "web-b"}}}
+
+	if err := notifySlack(server.URL, args, result, 3420*time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Found `Service started` in deployment `web` in namespace `default` after 3.4s\nMatching pods: `web-a`"
+	if message.Text != want {
+		t.Errorf("text = %q, want %q", message.Text, want)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	labels := map[string]string{"app": "agent"}
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+		Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+	objects := []runtime.Object{daemonSet}
+	for i, phase := range []corev1.PodPhase{corev1.PodRunning, corev1.PodPending} {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            fmt.Sprintf("agent-%c", 'a'+i),
+				Namespace:       "default",
+				Labels:          labels,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent"}},
+			},
+			Status: corev1.PodStatus{Phase: phase},
+		})
+	}
+	client := fake.NewClientset(objects...)
+	searcher := needle.NewSearcher(client)
+	searcher.Verbosity = needle.VerbosityQuiet
+	searcher.Stderr = io.Discard
+
+	args := Args{}
+	args.DaemonSetName = "agent"
+	args.Namespace = "default"
+
+	var stdout strings.Builder
+	if err := runDryRun(context.Background(), searcher, args, &stdout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Skipping non-running pod 'agent-b' (phase: Pending)\n" +
+		"Found 1 active pods for DaemonSet 'agent'\n" +
+		"Would search 1 pods of daemonset agent:\n" +
+		"  agent-a (phase: Running)\n"
+	if stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "log" {
+			t.Errorf("dry run opened a log stream")
+		}
+	}
+}
+
+func TestProgressDisplay(t *testing.T) {
+	var out strings.Builder
+	progress := newProgressDisplay(&out)
+	messages := progress.writer(&out)
+
+	progress.update("default", "web-a", needle.PodSearching)
+	progress.update("default", "web-bb", needle.PodSearching)
+	fmt.Fprintf(messages, "Found pattern in pod 'web-a'\n")
+	progress.update("default", "web-a", needle.PodMatched)
+	progress.stop()
+	fmt.Fprintf(messages, "Success\n")
+
+	want := "  web-a searching...\n" +
+		"\x1b[1A\r\x1b[J" +
+		"  web-a  searching...\n  web-bb searching...\n" +
+		"\x1b[2A\r\x1b[J" +
+		"Found pattern in pod 'web-a'\n" +
+		"  web-a  searching...\n  web-bb searching...\n" +
+		"\x1b[2A\r\x1b[J" +
+		"  web-a  matched\n  web-bb searching...\n" +
+		"Success\n"
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	beat := newHeartbeat(io.Discard)
+	if got, want := beat.line(5*time.Second), "Still searching... (5s elapsed)"; got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+
+	beat.update("default", "web-a", needle.PodMatched)
+	beat.update("default", "web-b", needle.PodSearching)
+	beat.update("default", "web-c", needle.PodSearching)
+	if got, want := beat.line(90*time.Second), "Still searching... (90s elapsed, 1/3 pods matched)"; got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+}
+
+func TestWriteTemplateReport(t *testing.T) {
+	args := Args{Template: "{{.Pod}}:{{.LineNumber}} {{.MatchedLine}}{{range .Pods}} [{{.PodName}} {{.Found}}]{{end}}"}
+	args.DeploymentName = "web"
+	result := needle.Result{Found: true, Pods: []needle.PodSearchResult{
+		{PodName: "web-a", Found: true, MatchedLine: "Service started", LineNumber: 3, MatchedAt: time.Now()},
+		{PodName: "web-b"},
+	}}
+
+	var out bytes.Buffer
+	if err := writeTemplateReport(&out, args, result, nil, time.Second, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "web-a:3 Service started [web-a true] [web-b false]\n"; out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+
+	if _, err := parseOutputTemplate("{{.Pod"); err == nil || !strings.Contains(err.Error(), "invalid -template") {
+		t.Errorf("err = %v, want an invalid template error", err)
+	}
+}
+
+func TestRegexHint(t *testing.T) {
+	for _, tt := range []struct {
+		pattern  string
+		regex    bool
+		wantHint bool
+	}{
+		{pattern: "error.*timeout", wantHint: true},
+		{pattern: `took \d+ms`, wantHint: true},
+		{pattern: "^Service started", wantHint: true},
+		{pattern: "error|warning", wantHint: true},
+		{pattern: "status [0-9]", wantHint: true},
+		{pattern: "error.*timeout", regex: true},
+		{pattern: "Service started (v1.2.3) [ready]"},
+		{pattern: "connection refused..."},
+	} {
+		args := Args{}
+		args.SearchPatterns = []string{tt.pattern}
+		args.Regex = tt.regex
+		if hint := regexHint(args); (hint != "") != tt.wantHint {
+			t.Errorf("%q (regex %v): hint = %q, want a hint: %v", tt.pattern, tt.regex, hint, tt.wantHint)
+		}
+	}
+}
+
+func TestGzipLogTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			io.WriteString(w, "plain")
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, "Service started\n")
+		zw.Close()
+	}))
+	defer server.Close()
+
+	// The transparent compression of the Go transport is off, as with disable-compression
+	client := &http.Client{Transport: gzipLogTransport{base: &http.Transport{DisableCompression: true}}}
+	for path, want := range map[string]string{
+		"/api/v1/namespaces/default/pods/app/log": "Service started\n",
+		"/api/v1/namespaces/default/pods/app":     "plain",
+	} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", path, err)
+		}
+		if string(body) != want {
+			t.Errorf("%s: body = %q, want %q", path, body, want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// matchFile appends the matched lines of every pod search to -output-file
+type matchFile struct {
+	mu   sync.Mutex
+	file *os.File
+	// First write error, reported when the file is closed
+	err error
+}
+
+// Open the match file for appending, creating it if missing
+func openMatchFile(path string) (*matchFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %v", err)
+	}
+	return &matchFile{file: file}, nil
+}
+
+// Write appends a line, keeping concurrent lines whole
+func (f *matchFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.file.Write(p)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+	return n, err
+}
+
+// Close flushes the file to disk and closes it, returning the first error met while writing
+func (f *matchFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	syncErr := f.file.Sync()
+	closeErr := f.file.Close()
+	switch {
+	case f.err != nil:
+		return fmt.Errorf("failed to write output file: %v", f.err)
+	case syncErr != nil:
+		return fmt.Errorf("failed to flush output file: %v", syncErr)
+	case closeErr != nil:
+		return fmt.Errorf("failed to close output file: %v", closeErr)
+	}
+	return nil
+}
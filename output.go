@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+	"golang.org/x/term"
+)
+
+// Output formats
+const (
+	outputText     = "text"
+	outputJSON     = "json"
+	outputTemplate = "template"
+)
+
+// Exit code when the targeted pod or resource doesn't exist, which -exit-error doesn't remap
+const exitResourceMissing = 5
+
+// Color and progress modes
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// jsonReport is the result document written with -output json
+type jsonReport struct {
+	Found          bool            `json:"found"`
+	Resource       *jsonResource   `json:"resource,omitempty"`
+	Resources      []jsonResource  `json:"resources,omitempty"`
+	Patterns       []string        `json:"patterns"`
+	Pods           []jsonPodResult `json:"pods"`
+	FirstMatch     *jsonFirstMatch `json:"firstMatch,omitempty"`
+	Summary        *jsonSummary    `json:"summary,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	ElapsedSeconds float64         `json:"elapsedSeconds"`
+	ExitCode       int             `json:"exitCode"`
+}
+
+// jsonSummary counts the pod outcomes of a resource search
+type jsonSummary struct {
+	Pods     int `json:"pods"`
+	Matched  int `json:"matched"`
+	Errored  int `json:"errored"`
+	TimedOut int `json:"timedOut"`
+}
+
+// jsonFirstMatch is the pod whose logs matched first, and its matched line
+type jsonFirstMatch struct {
+	Pod         string `json:"pod"`
+	Namespace   string `json:"namespace,omitempty"`
+	Container   string `json:"container,omitempty"`
+	LineNumber  int    `json:"lineNumber,omitempty"`
+	MatchedLine string `json:"matchedLine,omitempty"`
+}
+
+// jsonResource identifies the searched pod or resource
+type jsonResource struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// jsonPodResult is the outcome of searching a single pod
+type jsonPodResult struct {
+	Name        string                `json:"name"`
+	Namespace   string                `json:"namespace,omitempty"`
+	Found       bool                  `json:"found"`
+	Container   string                `json:"container,omitempty"`
+	MatchedLine string                `json:"matchedLine,omitempty"`
+	LineNumber  int                   `json:"lineNumber,omitempty"`
+	Error       string                `json:"error,omitempty"`
+	TimedOut    bool                  `json:"timedOut,omitempty"`
+	Matches     int                   `json:"matches,omitempty"`
+	Resource    *jsonResource         `json:"resource,omitempty"`
+	Diagnostic  *needle.PodDiagnostic `json:"diagnostic,omitempty"`
+}
+
+// Writer for progress messages, kept off stdout when it carries JSON or template output
+func infoOutput(args Args) io.Writer {
+	if args.Quiet {
+		return io.Discard
+	}
+	if reportOutput(args) {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Check whether the outcome is written as a JSON document or with -template instead of prose
+func reportOutput(args Args) bool {
+	return args.Output == outputJSON || args.Output == outputTemplate
+}
+
+// Check whether matches are highlighted in the lines written to w
+func useColor(mode string, w io.Writer) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	return isTerminal(w)
+}
+
+// Check whether w is a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
+// Writers for the result messages and errors, both discarded with -quiet
+func messageOutputs(args Args) (io.Writer, io.Writer) {
+	if args.Quiet {
+		return io.Discard, io.Discard
+	}
+	return os.Stdout, os.Stderr
+}
+
+// Exit code for the outcome of a search
+func searchExitCode(args Args, result needle.Result, err error) int {
+	switch {
+	case errors.Is(err, needle.ErrResourceNotFound):
+		return exitResourceMissing
+	case err != nil:
+		return args.ExitError
+	case args.Invert && result.Found:
+		return args.ExitInvert
+	case args.Invert:
+		return args.ExitFound
+	case result.Found:
+		return args.ExitFound
+	default:
+		return args.ExitNotFound
+	}
+}
+
+// The searched pod or resource as reported in JSON documents, nil when several are searched
+func searchedResource(args Args) *jsonResource {
+	if len(args.Targets) > 0 {
+		return nil
+	}
+	var resource jsonResource
+	if args.PodName != "" {
+		resource = jsonResource{Type: "pod", Name: args.PodName}
+	} else {
+		resourceType, resourceName := args.Resource()
+		resource = jsonResource{Type: string(resourceType), Name: resourceName}
+	}
+	if !spansNamespaces(args) {
+		resource.Namespace = args.Namespace
+	}
+	return &resource
+}
+
+// The pods and resources searched together as reported in JSON documents, nil for a single one
+func searchedTargets(args Args) []jsonResource {
+	var resources []jsonResource
+	for _, target := range args.Targets {
+		resource := jsonResource{Type: string(target.Type), Name: target.Name}
+		if !args.AllNamespaces {
+			resource.Namespace = args.Namespace
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+// The target a pod was searched for, only reported when several are searched together
+func podTarget(args Args, pod needle.PodSearchResult) *jsonResource {
+	if len(args.Targets) == 0 {
+		return nil
+	}
+	return &jsonResource{Type: string(pod.Target.Type), Name: pod.Target.Name}
+}
+
+// Write the search outcome as a single JSON document
+func writeJSONReport(w io.Writer, args Args, result needle.Result, searchErr error, elapsed time.Duration, exitCode int) error {
+	report := jsonReport{
+		Found:          result.Found,
+		Patterns:       args.SearchPatterns,
+		Pods:           []jsonPodResult{},
+		ElapsedSeconds: elapsed.Seconds(),
+		ExitCode:       exitCode,
+	}
+
+	report.Resource = searchedResource(args)
+	report.Resources = searchedTargets(args)
+	if searchErr != nil {
+		report.Error = searchErr.Error()
+	}
+
+	for _, pod := range result.Pods {
+		podResult := jsonPodResult{
+			Name:        pod.PodName,
+			Namespace:   pod.Namespace,
+			Found:       pod.Found,
+			Container:   pod.Container,
+			MatchedLine: pod.MatchedLine,
+			LineNumber:  pod.LineNumber,
+			TimedOut:    pod.TimedOut,
+			Matches:     pod.Matches,
+			Resource:    podTarget(args, pod),
+			Diagnostic:  pod.Diagnostic,
+		}
+		if pod.Error != nil {
+			podResult.Error = pod.Error.Error()
+		}
+		report.Pods = append(report.Pods, podResult)
+	}
+	if first, ok := result.FirstMatch(); ok {
+		report.FirstMatch = &jsonFirstMatch{
+			Pod:         first.PodName,
+			Namespace:   first.Namespace,
+			Container:   first.Container,
+			LineNumber:  first.LineNumber,
+			MatchedLine: first.MatchedLine,
+		}
+	}
+	if !singlePod(args) && len(result.Pods) > 0 {
+		summary := result.Summary()
+		report.Summary = &jsonSummary{
+			Pods:     summary.Pods,
+			Matched:  summary.Matched,
+			Errored:  summary.Errored,
+			TimedOut: summary.TimedOut,
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// templateData is the value the -template is executed with
+type templateData struct {
+	Found    bool
+	Target   string
+	Patterns []string
+	// Pod, Namespace, Container, MatchedLine and LineNumber describe the first match, if any
+	Pod         string
+	Namespace   string
+	Container   string
+	MatchedLine string
+	LineNumber  int
+	// Pods holds the per-pod outcomes, each with PodName, Namespace, Found, MatchedLine, Error...
+	Pods     []needle.PodSearchResult
+	Error    string
+	Elapsed  time.Duration
+	ExitCode int
+}
+
+// Parse the -template text
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// Write the search outcome with the -template, ending it with a newline
+func writeTemplateReport(w io.Writer, args Args, result needle.Result, searchErr error, elapsed time.Duration, exitCode int) error {
+	tmpl, err := parseOutputTemplate(args.Template)
+	if err != nil {
+		return err
+	}
+	data := templateData{
+		Found:    result.Found,
+		Target:   describeTarget(args),
+		Patterns: args.SearchPatterns,
+		Pods:     result.Pods,
+		Elapsed:  elapsed.Round(time.Millisecond),
+		ExitCode: exitCode,
+	}
+	if first, ok := result.FirstMatch(); ok {
+		data.Pod = first.PodName
+		data.Namespace = first.Namespace
+		data.Container = first.Container
+		data.MatchedLine = first.MatchedLine
+		data.LineNumber = first.LineNumber
+	}
+	if searchErr != nil {
+		data.Error = searchErr.Error()
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(out.String(), "\n") {
+		out.WriteString("\n")
+	}
+	_, err = io.WriteString(w, out.String())
+	return err
+}
+
+// Write the summary table of a resource search
+func writeSummary(w io.Writer, args Args, result needle.Result, elapsed time.Duration) {
+	summary := result.Summary()
+	fmt.Fprintf(w, "Summary of %s:\n", describeTarget(args))
+	fmt.Fprintf(w, "  %-12s %d\n", "Pods", summary.Pods)
+	fmt.Fprintf(w, "  %-12s %d\n", "Matched", summary.Matched)
+	fmt.Fprintf(w, "  %-12s %d\n", "Errored", summary.Errored)
+	fmt.Fprintf(w, "  %-12s %d\n", "Timed out", summary.TimedOut)
+	fmt.Fprintf(w, "  %-12s %s\n", "Elapsed", elapsed.Round(time.Millisecond))
+
+	// Attribute the pods to the targets searched together
+	for _, target := range args.Targets {
+		pods, matched := 0, 0
+		for _, pod := range result.Pods {
+			if pod.Target == target {
+				pods++
+				if pod.Found {
+					matched++
+				}
+			}
+		}
+		fmt.Fprintf(w, "  %s %s: %d of %d pods matched\n", target.Type, target.Name, matched, pods)
+	}
+
+	// Group the pods by namespace, in which order they were searched
+	if args.NamespaceSelector != "" {
+		var namespaces []string
+		pods, matched := make(map[string]int), make(map[string]int)
+		for _, pod := range result.Pods {
+			if _, ok := pods[pod.Namespace]; !ok {
+				namespaces = append(namespaces, pod.Namespace)
+			}
+			pods[pod.Namespace]++
+			if pod.Found {
+				matched[pod.Namespace]++
+			}
+		}
+		for _, namespace := range namespaces {
+			fmt.Fprintf(w, "  namespace %s: %d of %d pods matched\n", namespace, matched[namespace], pods[namespace])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package needle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrAccessDenied is returned by CheckAccess when the RBAC rules forbid a request the search needs
+var ErrAccessDenied = errors.New("access denied")
+
+// accessCheck is a permission needed by a search
+type accessCheck struct {
+	verb        string
+	group       string
+	resource    string
+	subresource string
+	// Set for cluster-scoped resources, checked outside of any namespace
+	clusterScoped bool
+}
+
+// Name of the checked resource as written in RBAC rules, e.g. pods/log
+func (c accessCheck) String() string {
+	name := c.resource
+	if c.subresource != "" {
+		name += "/" + c.subresource
+	}
+	if c.group != "" {
+		name += "." + c.group
+	}
+	return name
+}
+
+// Workload requests made while discovering the pods of each resource type
+var resourceAccessChecks = map[ResourceType][]accessCheck{
+	// The active ReplicaSet is picked among the listed ones
+	ResourceTypeDeployment: {
+		{verb: "get", group: "apps", resource: "deployments"},
+		{verb: "list", group: "apps", resource: "replicasets"},
+	},
+	ResourceTypeStatefulSet: {{verb: "get", group: "apps", resource: "statefulsets"}},
+	ResourceTypeDaemonSet:   {{verb: "get", group: "apps", resource: "daemonsets"}},
+	ResourceTypeJob:         {{verb: "get", group: "batch", resource: "jobs"}},
+	// The most recent Job is picked among the listed ones, then looked up
+	ResourceTypeCronJob: {
+		{verb: "get", group: "batch", resource: "cronjobs"},
+		{verb: "list", group: "batch", resource: "jobs"},
+		{verb: "get", group: "batch", resource: "jobs"},
+	},
+	// DeploymentConfigs are resolved through their ReplicationControllers
+	ResourceTypeDeploymentConfig: {{verb: "list", resource: "replicationcontrollers"}},
+}
+
+// Permissions a search with the given options needs
+func accessChecks(opts Options) []accessCheck {
+	targets := opts.Targets
+	if len(targets) == 0 && opts.PodName != "" {
+		targets = []Target{{Type: ResourceTypePod, Name: opts.PodName}}
+	} else if len(targets) == 0 {
+		resourceType, resourceName := opts.Resource()
+		targets = []Target{{Type: resourceType, Name: resourceName}}
+	}
+
+	var checks []accessCheck
+	if opts.NamespaceSelector != "" {
+		checks = append(checks, accessCheck{verb: "list", resource: "namespaces", clusterScoped: true})
+	}
+	listsPods := opts.AllNamespaces
+	checked := make(map[ResourceType]bool)
+	for _, target := range targets {
+		if !checked[target.Type] {
+			checks = append(checks, resourceAccessChecks[target.Type]...)
+		}
+		checked[target.Type] = true
+		listsPods = listsPods || target.Type != ResourceTypePod || IsPodPattern(target.Name)
+	}
+	checks = append(checks, accessCheck{verb: "get", resource: "pods"})
+	if listsPods {
+		checks = append(checks, accessCheck{verb: "list", resource: "pods"})
+	}
+	if opts.WatchPods {
+		checks = append(checks, accessCheck{verb: "watch", resource: "pods"})
+	}
+	return append(checks, accessCheck{verb: "get", resource: "pods", subresource: "log"})
+}
+
+// CheckAccess asks the API server with SelfSubjectAccessReviews whether the current user may make
+// the requests the search needs, so that missing RBAC rules are reported before any discovery.
+// With Options.NamespaceSelector, the namespaced requests are checked in every selected namespace.
+func (s *Searcher) CheckAccess(ctx context.Context, opts Options) error {
+	checks := accessChecks(opts)
+	for _, check := range checks {
+		if check.clusterScoped {
+			if err := s.checkAccess(ctx, check, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	namespaces := []string{opts.searchNamespace()}
+	if opts.NamespaceSelector != "" {
+		list, err := retryAPI(ctx, s, opts, func() (*corev1.NamespaceList, error) {
+			return s.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: opts.NamespaceSelector})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list namespaces matching '%s': %w", opts.NamespaceSelector, err)
+		}
+		namespaces = namespaces[:0]
+		for _, namespace := range list.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+		sort.Strings(namespaces)
+	}
+
+	for _, namespace := range namespaces {
+		for _, check := range checks {
+			if check.clusterScoped {
+				continue
+			}
+			if err := s.checkAccess(ctx, check, namespace); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Check a single permission in the given namespace, or in the cluster for cluster-scoped resources
+func (s *Searcher) checkAccess(ctx context.Context, check accessCheck, namespace string) error {
+	where := fmt.Sprintf("namespace '%s'", namespace)
+	if check.clusterScoped {
+		where = "the cluster"
+	} else if namespace == metav1.NamespaceAll {
+		where = "all namespaces"
+	}
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        check.verb,
+				Group:       check.group,
+				Resource:    check.resource,
+				Subresource: check.subresource,
+			},
+		},
+	}
+	result, err := s.client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to check access to %s: %w", check, err)
+	}
+	if !result.Status.Allowed {
+		return fmt.Errorf("%w: you lack '%s' on %s in %s", ErrAccessDenied, check.verb, check, where)
+	}
+	s.logf(VerbosityLogs, "Access to '%s' on %s in %s allowed\n", check.verb, check, where)
+	return nil
+}
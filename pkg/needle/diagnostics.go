@@ -0,0 +1,137 @@
+package needle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodDiagnostic is a concise snapshot of a pod's status, collected when a search errors
+type PodDiagnostic struct {
+	Phase      string                `json:"phase"`
+	Reason     string                `json:"reason,omitempty"`
+	Message    string                `json:"message,omitempty"`
+	Conditions []ConditionDiagnostic `json:"conditions,omitempty"`
+	Containers []ContainerDiagnostic `json:"containers,omitempty"`
+}
+
+// ConditionDiagnostic describes a single pod condition
+type ConditionDiagnostic struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ContainerDiagnostic describes the state of a single container
+type ContainerDiagnostic struct {
+	Name         string `json:"name"`
+	Ready        bool   `json:"ready"`
+	RestartCount int32  `json:"restartCount"`
+	State        string `json:"state"`
+	Reason       string `json:"reason,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// diagnosticTimeout bounds the extra API call made to collect pod diagnostics
+const diagnosticTimeout = 10 * time.Second
+
+// Collect diagnostics for a failed pod, reporting on Stderr when they can't be fetched
+func (s *Searcher) collectDiagnostic(podName string, opts Options) *PodDiagnostic {
+	diagnostic, err := s.diagnosePod(opts.Namespace, podName)
+	if err != nil {
+		fmt.Fprintf(s.Stderr, "Unable to collect diagnostics for pod '%s': %v\n", podName, err)
+		return nil
+	}
+	return diagnostic
+}
+
+// Fetch a pod and summarize its status for troubleshooting failed searches
+func (s *Searcher) diagnosePod(namespace, podName string) (*PodDiagnostic, error) {
+	// Use a fresh context: the search context may already be canceled or expired
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticTimeout)
+	defer cancel()
+
+	pod, err := s.client.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod '%s' in namespace '%s': %w", podName, namespace, err)
+	}
+
+	diagnostic := &PodDiagnostic{
+		Phase:   string(pod.Status.Phase),
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		diagnostic.Conditions = append(diagnostic.Conditions, ConditionDiagnostic{
+			Type:    string(condition.Type),
+			Status:  string(condition.Status),
+			Reason:  condition.Reason,
+			Message: condition.Message,
+		})
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		container := ContainerDiagnostic{
+			Name:         status.Name,
+			Ready:        status.Ready,
+			RestartCount: status.RestartCount,
+		}
+		switch {
+		case status.State.Waiting != nil:
+			container.State = "Waiting"
+			container.Reason = status.State.Waiting.Reason
+			container.Message = status.State.Waiting.Message
+		case status.State.Terminated != nil:
+			container.State = "Terminated"
+			container.Reason = status.State.Terminated.Reason
+			container.Message = status.State.Terminated.Message
+		case status.State.Running != nil:
+			container.State = "Running"
+		default:
+			container.State = "Unknown"
+		}
+		diagnostic.Containers = append(diagnostic.Containers, container)
+	}
+
+	return diagnostic, nil
+}
+
+// WriteDiagnostic writes a human-readable pod diagnostic block to w
+func WriteDiagnostic(w io.Writer, podName string, diagnostic *PodDiagnostic) {
+	fmt.Fprintf(w, "Diagnostics for pod '%s':\n", podName)
+	fmt.Fprintf(w, "  Phase: %s%s\n", diagnostic.Phase, formatReason(diagnostic.Reason, diagnostic.Message))
+
+	if len(diagnostic.Conditions) > 0 {
+		fmt.Fprintf(w, "  Conditions:\n")
+		for _, condition := range diagnostic.Conditions {
+			fmt.Fprintf(w, "    %s=%s%s\n", condition.Type, condition.Status,
+				formatReason(condition.Reason, condition.Message))
+		}
+	}
+
+	if len(diagnostic.Containers) > 0 {
+		fmt.Fprintf(w, "  Containers:\n")
+		for _, container := range diagnostic.Containers {
+			fmt.Fprintf(w, "    %s: %s%s (ready: %t, restarts: %d)\n", container.Name, container.State,
+				formatReason(container.Reason, container.Message), container.Ready, container.RestartCount)
+		}
+	}
+}
+
+// Format an optional reason and message as a parenthesized suffix
+func formatReason(reason, message string) string {
+	switch {
+	case reason != "" && message != "":
+		return fmt.Sprintf(" (%s: %s)", reason, message)
+	case reason != "":
+		return fmt.Sprintf(" (%s)", reason)
+	case message != "":
+		return fmt.Sprintf(" (%s)", message)
+	}
+	return ""
+}
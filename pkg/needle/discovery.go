@@ -0,0 +1,917 @@
+package needle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ErrResourceNotFound is returned when the targeted pod or resource doesn't exist
+var ErrResourceNotFound = errors.New("not found")
+
+// ErrZeroReplicas is returned when the targeted deployment or statefulset is scaled to zero
+var ErrZeroReplicas = errors.New("0 desired replicas")
+
+// ErrNoActivePods is returned when none of the pods of the targeted resource can be searched
+var ErrNoActivePods = errors.New("no active pods found")
+
+// notFoundError reports a pod or resource that doesn't exist, matching both ErrResourceNotFound
+// and the Kubernetes API error, so apierrors.IsNotFound holds too
+type notFoundError struct {
+	msg string
+	err error
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Unwrap() []error {
+	return []error{ErrResourceNotFound, e.err}
+}
+
+// Annotation in which the deployment controller records the revision of each of its ReplicaSets
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// retryBackoff is the delay before the first retry of a transient API error, doubled for each
+// further retry
+const retryBackoff = 500 * time.Millisecond
+
+// DiscoverPods returns the pods targeted by the options: the named pod, or the active pods
+// of the targeted resource
+func (s *Searcher) DiscoverPods(ctx context.Context, opts Options) ([]corev1.Pod, error) {
+	if len(opts.Targets) > 0 {
+		pods, _, err := s.discoverTargetPods(ctx, opts)
+		return pods, err
+	}
+	if opts.NamespaceSelector != "" {
+		return s.discoverSelectedNamespacePods(ctx, opts)
+	}
+	if IsPodPattern(opts.PodName) {
+		return s.getPodsFromPattern(ctx, opts.PodName, opts)
+	}
+	if opts.PodName != "" && opts.AllNamespaces {
+		pod, err := s.findPodInAllNamespaces(ctx, opts.PodName, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+	if opts.PodName != "" {
+		pod, err := retryAPI(ctx, s, opts, func() (*corev1.Pod, error) {
+			return s.client.CoreV1().Pods(opts.Namespace).Get(ctx, opts.PodName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return nil, lookupError("pod", opts.PodName, opts.Namespace, err)
+		}
+		return []corev1.Pod{*pod}, nil
+	}
+	if resourceType, resourceName := opts.Resource(); resourceType != "" {
+		return s.getPodsFromResource(ctx, resourceType, resourceName, opts)
+	}
+	return nil, fmt.Errorf("either a pod name, a deployment, statefulset, daemonset, job, cronjob or deploymentconfig name, or a label selector is required")
+}
+
+// Find a pod by name across all namespaces
+func (s *Searcher) findPodInAllNamespaces(ctx context.Context, podName string, opts Options) (*corev1.Pod, error) {
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", podName).String(),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods named '%s' in all namespaces: %w", podName, err)
+	}
+
+	switch len(pods.Items) {
+	case 0:
+		return nil, fmt.Errorf("pod '%s' %w in any namespace", podName, ErrResourceNotFound)
+	case 1:
+		return &pods.Items[0], nil
+	}
+
+	namespaces := []string{}
+	for _, pod := range pods.Items {
+		namespaces = append(namespaces, pod.Namespace)
+	}
+	return nil, fmt.Errorf("pod '%s' exists in several namespaces (%s), please specify one with -namespace",
+		podName, strings.Join(namespaces, ", "))
+}
+
+// Get the active pods of the targeted resource in every namespace matching
+// Options.NamespaceSelector, grouped by namespace in name order; namespaces where the resource
+// doesn't exist or has no active pods are skipped
+func (s *Searcher) discoverSelectedNamespacePods(ctx context.Context, opts Options) ([]corev1.Pod, error) {
+	resourceType, resourceName := opts.Resource()
+	if opts.PodName != "" || resourceType == "" {
+		return nil, fmt.Errorf("a namespace selector requires a deployment, statefulset, daemonset, job, cronjob or deploymentconfig name, or a label selector")
+	}
+
+	namespaces, err := retryAPI(ctx, s, opts, func() (*corev1.NamespaceList, error) {
+		return s.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: opts.NamespaceSelector})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces matching '%s': %w", opts.NamespaceSelector, err)
+	}
+	if len(namespaces.Items) == 0 {
+		return nil, fmt.Errorf("no namespaces match selector '%s'", opts.NamespaceSelector)
+	}
+	names := make([]string, len(namespaces.Items))
+	for i, namespace := range namespaces.Items {
+		names[i] = namespace.Name
+	}
+	sort.Strings(names)
+
+	var pods []corev1.Pod
+	for _, namespace := range names {
+		namespaceOpts := opts
+		namespaceOpts.Namespace = namespace
+		namespacePods, err := s.getPodsFromResource(ctx, resourceType, resourceName, namespaceOpts)
+		if errors.Is(err, ErrResourceNotFound) || errors.Is(err, ErrNoActivePods) || errors.Is(err, ErrZeroReplicas) {
+			s.warnf(VerbosityDiscovery, "Skipping namespace '%s': %v\n", namespace, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.warnf(VerbosityDiscovery, "Found %d pods for %s '%s' in namespace '%s'\n", len(namespacePods), resourceType, resourceName, namespace)
+		pods = append(pods, namespacePods...)
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("%w for %s '%s' in namespaces matching '%s'", ErrNoActivePods, resourceType, resourceName, opts.NamespaceSelector)
+	}
+	return pods, nil
+}
+
+// Make a discovery API call, retrying transient errors (timeouts, throttling and server errors)
+// up to Options.MaxRetries times with exponential backoff until ctx is done
+func retryAPI[T any](ctx context.Context, s *Searcher, opts Options, call func() (T, error)) (T, error) {
+	delay := retryBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := call()
+		if err == nil || attempt > opts.MaxRetries || !retryableError(err) {
+			return result, err
+		}
+		s.warnf(VerbosityDiscovery, "Kubernetes API error (%v), retrying in %s (%d/%d)\n", err, delay, attempt, opts.MaxRetries)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Check whether an API error is transient
+func retryableError(err error) bool {
+	if apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	return errors.As(err, &status) && status.Status().Code >= 500
+}
+
+// Error for a failed lookup of a pod or resource, wrapping ErrResourceNotFound when it doesn't exist
+func lookupError(kind, name, namespace string, err error) error {
+	if apierrors.IsNotFound(err) {
+		return &notFoundError{msg: fmt.Sprintf("%s '%s' %s in namespace '%s'", kind, name, ErrResourceNotFound, namespace), err: err}
+	}
+	return fmt.Errorf("failed to find %s '%s' in namespace '%s': %w", kind, name, namespace, err)
+}
+
+// Get the pods of every target, keyed by namespace and name to the first target that selected
+// them; a pod selected by several targets is only returned once
+func (s *Searcher) discoverTargetPods(ctx context.Context, opts Options) ([]corev1.Pod, map[string]Target, error) {
+	var pods []corev1.Pod
+	podTargets := make(map[string]Target)
+	for _, target := range opts.Targets {
+		var targetPods []corev1.Pod
+		var err error
+		switch {
+		case target.Type == ResourceTypePod && IsPodPattern(target.Name):
+			targetPods, err = s.getPodsFromPattern(ctx, target.Name, opts)
+			if err == nil {
+				s.warnf(VerbosityDiscovery, "Found %d pods for %s\n", len(targetPods), target)
+			}
+		case target.Type == ResourceTypePod && opts.AllNamespaces:
+			var pod *corev1.Pod
+			if pod, err = s.findPodInAllNamespaces(ctx, target.Name, opts); err == nil {
+				targetPods = []corev1.Pod{*pod}
+			}
+		case target.Type == ResourceTypePod:
+			var pod *corev1.Pod
+			pod, err = retryAPI(ctx, s, opts, func() (*corev1.Pod, error) {
+				return s.client.CoreV1().Pods(opts.Namespace).Get(ctx, target.Name, metav1.GetOptions{})
+			})
+			if err != nil {
+				err = lookupError("pod", target.Name, opts.Namespace, err)
+			} else {
+				targetPods = []corev1.Pod{*pod}
+			}
+		default:
+			targetPods, err = s.getPodsFromResource(ctx, target.Type, target.Name, opts)
+			if err == nil {
+				s.warnf(VerbosityDiscovery, "Found %d pods for %s\n", len(targetPods), target)
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, pod := range targetPods {
+			key := pod.Namespace + "/" + pod.Name
+			if _, ok := podTargets[key]; ok {
+				continue
+			}
+			podTargets[key] = target
+			pods = append(pods, pod)
+		}
+	}
+	return pods, podTargets, nil
+}
+
+// Get the active pods of a workload resource
+func (s *Searcher) getPodsFromResource(ctx context.Context, resourceType ResourceType, resourceName string, opts Options) ([]corev1.Pod, error) {
+	switch resourceType {
+	case ResourceTypeDeployment:
+		return s.getPodsFromDeployment(ctx, resourceName, opts)
+	case ResourceTypeStatefulSet:
+		return s.getPodsFromStatefulSet(ctx, resourceName, opts)
+	case ResourceTypeDaemonSet:
+		return s.getPodsFromDaemonSet(ctx, resourceName, opts)
+	case ResourceTypeJob:
+		return s.getPodsFromJob(ctx, resourceName, opts)
+	case ResourceTypeCronJob:
+		return s.getPodsFromCronJob(ctx, resourceName, opts)
+	case ResourceTypeDeploymentConfig:
+		return s.getPodsFromDeploymentConfig(ctx, resourceName, opts)
+	case ResourceTypeSelector:
+		return s.getPodsFromSelector(ctx, resourceName, opts)
+	case ResourceTypePod:
+		return s.getPodsFromPattern(ctx, resourceName, opts)
+	}
+	return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
+}
+
+// Get pods from a deployment
+func (s *Searcher) getPodsFromDeployment(ctx context.Context, deploymentName string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	// Get the deployment
+	deployment, err := retryAPI(ctx, s, opts, func() (*appsv1.Deployment, error) {
+		return s.client.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, lookupError("deployment", deploymentName, namespace, err)
+	}
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 {
+		return nil, fmt.Errorf("deployment '%s' has %w", deploymentName, ErrZeroReplicas)
+	}
+
+	// Explicitly use appsv1 type to avoid unused import
+	var _ appsv1.Deployment = appsv1.Deployment{}
+
+	// Get the selector from the deployment
+	selector := deployment.Spec.Selector
+	labelSelector := labels.SelectorFromSet(selector.MatchLabels)
+
+	// List pods with the selector
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+			FieldSelector: opts.FieldSelector,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for deployment '%s': %w", deploymentName, err)
+	}
+
+	// Get the ReplicaSet that's currently owned by the deployment
+	replicaSets, err := retryAPI(ctx, s, opts, func() (*appsv1.ReplicaSetList, error) {
+		return s.client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ReplicaSets for deployment '%s': %w", deploymentName, err)
+	}
+
+	// Find the active ReplicaSet: the one of the deployment's current revision, which a rollback
+	// moves to the ReplicaSet of the restored template
+	var activeReplicaSet *appsv1.ReplicaSet
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		// Check if this ReplicaSet is owned by our deployment
+		for _, owner := range rs.OwnerReferences {
+			if owner.Kind == "Deployment" && owner.Name == deploymentName {
+				if activeReplicaSet == nil || newerReplicaSet(rs, activeReplicaSet) {
+					activeReplicaSet = rs
+				}
+				break
+			}
+		}
+	}
+
+	if activeReplicaSet == nil && !opts.LenientOwner {
+		return nil, fmt.Errorf("no active ReplicaSet found for deployment '%s'", deploymentName)
+	}
+	if activeReplicaSet == nil {
+		s.warnf(VerbosityDiscovery, "Warning: no active ReplicaSet found for deployment '%s', searching the pods matching its selector '%s'\n",
+			deploymentName, labelSelector)
+	}
+
+	// Filter pods to only include those from the active ReplicaSet and not terminating
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s' (has deletion timestamp, see -include-terminating)\n", pod.Name)
+			continue
+		}
+
+		// Skip pods that are not in Running phase, or fail in strict mode
+		if pod.Status.Phase != corev1.PodRunning && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, "deployment", deploymentName)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping non-running pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
+			continue
+		}
+
+		// Without a ReplicaSet, every pod matching the selector belongs to the deployment; so do
+		// the terminating pods of earlier revisions during a rollout
+		if activeReplicaSet == nil || (pod.DeletionTimestamp != nil && opts.IncludeTerminating) {
+			activePods = append(activePods, pod)
+			continue
+		}
+
+		// Check if this pod belongs to the active ReplicaSet, by its pod template hash or else
+		// by its owner
+		isOwnedByActiveRS := false
+		if hash := activeReplicaSet.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; hash != "" {
+			isOwnedByActiveRS = pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] == hash
+		} else {
+			for _, owner := range pod.OwnerReferences {
+				if owner.Kind == "ReplicaSet" && owner.Name == activeReplicaSet.Name {
+					isOwnedByActiveRS = true
+					break
+				}
+			}
+		}
+
+		if !isOwnedByActiveRS {
+			s.warnf(VerbosityDiscovery, "Skipping pod '%s' (not owned by the active ReplicaSet '%s')\n", pod.Name, activeReplicaSet.Name)
+			continue
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for deployment '%s'", ErrNoActivePods, deploymentName)
+	}
+
+	if activeReplicaSet == nil {
+		s.warnf(VerbosityDiscovery, "Found %d active pods matching the selector of deployment '%s'\n", len(activePods), deploymentName)
+		return activePods, nil
+	}
+	s.warnf(VerbosityDiscovery, "Found %d active pods from ReplicaSet '%s' for deployment '%s'\n",
+		len(activePods), activeReplicaSet.Name, deploymentName)
+	return activePods, nil
+}
+
+// Check whether a ReplicaSet of a deployment is of a later revision than another, falling back to
+// the one with more replicas when their revision annotations are missing or equal
+func newerReplicaSet(rs, other *appsv1.ReplicaSet) bool {
+	revision, otherRevision := replicaSetRevision(rs), replicaSetRevision(other)
+	if revision != otherRevision {
+		return revision > otherRevision
+	}
+	return replicaCount(rs) > replicaCount(other)
+}
+
+// Revision of a ReplicaSet from its deployment.kubernetes.io/revision annotation, 0 if unset
+func replicaSetRevision(rs *appsv1.ReplicaSet) int64 {
+	revision, err := strconv.ParseInt(rs.Annotations[deploymentRevisionAnnotation], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return revision
+}
+
+// Desired replicas of a ReplicaSet, 1 when unset as defaulted by the API server
+func replicaCount(rs *appsv1.ReplicaSet) int32 {
+	if rs.Spec.Replicas == nil {
+		return 1
+	}
+	return *rs.Spec.Replicas
+}
+
+// Get pods from a statefulset
+func (s *Searcher) getPodsFromStatefulSet(ctx context.Context, statefulSetName string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	// Get the statefulset
+	statefulSet, err := retryAPI(ctx, s, opts, func() (*appsv1.StatefulSet, error) {
+		return s.client.AppsV1().StatefulSets(namespace).Get(ctx, statefulSetName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, lookupError("statefulset", statefulSetName, namespace, err)
+	}
+	if statefulSet.Spec.Replicas != nil && *statefulSet.Spec.Replicas == 0 {
+		return nil, fmt.Errorf("statefulset '%s' has %w", statefulSetName, ErrZeroReplicas)
+	}
+
+	// Get the selector from the statefulset
+	selector := statefulSet.Spec.Selector
+	labelSelector := labels.SelectorFromSet(selector.MatchLabels)
+
+	// List pods with the selector
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+			FieldSelector: opts.FieldSelector,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for statefulset '%s': %w", statefulSetName, err)
+	}
+
+	// Get the current revision and update revision from the StatefulSet status
+	currentRevision := statefulSet.Status.CurrentRevision
+	updateRevision := statefulSet.Status.UpdateRevision
+
+	// If updateRevision is set and different from currentRevision, a rolling update is in progress
+	isRollingUpdate := updateRevision != "" && updateRevision != currentRevision
+
+	if isRollingUpdate {
+		s.warnf(VerbosityDiscovery, "StatefulSet '%s' is undergoing a rolling update (current: %s, update: %s)\n",
+			statefulSetName, currentRevision, updateRevision)
+	}
+
+	// Filter out terminating pods and ensure they belong to the StatefulSet
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s' (has deletion timestamp, see -include-terminating)\n", pod.Name)
+			continue
+		}
+
+		// Skip pods that are not in Running phase, or fail in strict mode
+		if pod.Status.Phase != corev1.PodRunning && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, "statefulset", statefulSetName)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping non-running pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
+			continue
+		}
+
+		// Check if this pod is owned by the StatefulSet
+		isOwnedByStatefulSet := false
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind == "StatefulSet" && owner.Name == statefulSetName {
+				isOwnedByStatefulSet = true
+				break
+			}
+		}
+
+		if !isOwnedByStatefulSet {
+			s.warnf(VerbosityDiscovery, "Skipping pod '%s' (not owned by the StatefulSet '%s')\n", pod.Name, statefulSetName)
+			continue
+		}
+
+		// If a rolling update is in progress, check the pod's controller-revision-hash label
+		if isRollingUpdate {
+			// Get the controller-revision-hash label
+			revisionHash, ok := pod.Labels["controller-revision-hash"]
+			if !ok {
+				s.warnf(VerbosityDiscovery, "Skipping pod '%s' (missing controller-revision-hash label)\n", pod.Name)
+				continue
+			}
+
+			// During a rolling update, we want to include only pods with the update revision
+			if revisionHash != updateRevision {
+				s.warnf(VerbosityDiscovery, "Skipping pod '%s' (old revision: %s, target: %s)\n",
+					pod.Name, revisionHash, updateRevision)
+				continue
+			}
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for statefulset '%s'", ErrNoActivePods, statefulSetName)
+	}
+
+	s.warnf(VerbosityDiscovery, "Found %d active pods for StatefulSet '%s'\n", len(activePods), statefulSetName)
+	return activePods, nil
+}
+
+// Get pods from a daemonset
+func (s *Searcher) getPodsFromDaemonSet(ctx context.Context, daemonSetName string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	// Get the daemonset
+	daemonSet, err := retryAPI(ctx, s, opts, func() (*appsv1.DaemonSet, error) {
+		return s.client.AppsV1().DaemonSets(namespace).Get(ctx, daemonSetName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, lookupError("daemonset", daemonSetName, namespace, err)
+	}
+
+	// Get the selector from the daemonset
+	selector := daemonSet.Spec.Selector
+	labelSelector := labels.SelectorFromSet(selector.MatchLabels)
+
+	// List pods with the selector
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+			FieldSelector: opts.FieldSelector,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for daemonset '%s': %w", daemonSetName, err)
+	}
+
+	// Filter out terminating pods and ensure they belong to the DaemonSet
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s' (has deletion timestamp, see -include-terminating)\n", pod.Name)
+			continue
+		}
+
+		// Skip pods that are not in Running phase, or fail in strict mode
+		if pod.Status.Phase != corev1.PodRunning && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, "daemonset", daemonSetName)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping non-running pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
+			continue
+		}
+
+		// Check if this pod is owned by the DaemonSet
+		isOwnedByDaemonSet := false
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind == "DaemonSet" && owner.Name == daemonSetName {
+				isOwnedByDaemonSet = true
+				break
+			}
+		}
+
+		if !isOwnedByDaemonSet {
+			s.warnf(VerbosityDiscovery, "Skipping pod '%s' (not owned by the DaemonSet '%s')\n", pod.Name, daemonSetName)
+			continue
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for daemonset '%s'", ErrNoActivePods, daemonSetName)
+	}
+
+	s.warnf(VerbosityDiscovery, "Found %d active pods for DaemonSet '%s'\n", len(activePods), daemonSetName)
+	return activePods, nil
+}
+
+// Get pods from a job, including pods that already completed
+func (s *Searcher) getPodsFromJob(ctx context.Context, jobName string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	// Get the job
+	job, err := retryAPI(ctx, s, opts, func() (*batchv1.Job, error) {
+		return s.client.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, lookupError("job", jobName, namespace, err)
+	}
+
+	// Get the selector from the job, falling back to the label set on every job pod
+	labelSelector := labels.SelectorFromSet(labels.Set{batchv1.JobNameLabel: jobName})
+	if job.Spec.Selector != nil {
+		labelSelector, err = metav1.LabelSelectorAsSelector(job.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector for job '%s': %w", jobName, err)
+		}
+	}
+
+	// List pods with the selector
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+			FieldSelector: opts.FieldSelector,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for job '%s': %w", jobName, err)
+	}
+
+	// Filter out terminating and not yet started pods and ensure they belong to the Job
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s' (has deletion timestamp, see -include-terminating)\n", pod.Name)
+			continue
+		}
+
+		// Job pods are searched while running and after they completed
+		if pod.Status.Phase != corev1.PodRunning && !podCompleted(&pod) && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, "job", jobName)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
+			continue
+		}
+
+		// Check if this pod is owned by the Job
+		isOwnedByJob := false
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind == "Job" && owner.Name == jobName {
+				isOwnedByJob = true
+				break
+			}
+		}
+
+		if !isOwnedByJob {
+			s.warnf(VerbosityDiscovery, "Skipping pod '%s' (not owned by the Job '%s')\n", pod.Name, jobName)
+			continue
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for job '%s' (none running or completed)", ErrNoActivePods, jobName)
+	}
+
+	s.warnf(VerbosityDiscovery, "Found %d pods for Job '%s'\n", len(activePods), jobName)
+	return activePods, nil
+}
+
+// Get pods from the most recent job created by a cronjob
+func (s *Searcher) getPodsFromCronJob(ctx context.Context, cronJobName string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	// Check that the cronjob exists
+	_, err := retryAPI(ctx, s, opts, func() (*batchv1.CronJob, error) {
+		return s.client.BatchV1().CronJobs(namespace).Get(ctx, cronJobName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, lookupError("cronjob", cronJobName, namespace, err)
+	}
+
+	jobs, err := retryAPI(ctx, s, opts, func() (*batchv1.JobList, error) {
+		return s.client.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs for cronjob '%s': %w", cronJobName, err)
+	}
+
+	// Find the most recently created job owned by the cronjob
+	var latestJob *batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		for _, owner := range job.OwnerReferences {
+			if owner.Kind == "CronJob" && owner.Name == cronJobName {
+				if latestJob == nil || latestJob.CreationTimestamp.Before(&job.CreationTimestamp) {
+					latestJob = job
+				}
+				break
+			}
+		}
+	}
+
+	if latestJob == nil {
+		return nil, fmt.Errorf("no jobs found for cronjob '%s'", cronJobName)
+	}
+
+	s.warnf(VerbosityDiscovery, "Using the most recent Job '%s' of CronJob '%s'\n", latestJob.Name, cronJobName)
+	return s.getPodsFromJob(ctx, latestJob.Name, opts)
+}
+
+// Labels and annotation OpenShift sets on the ReplicationControllers and pods of a DeploymentConfig
+const (
+	// On each ReplicationController, the name of its DeploymentConfig
+	deploymentConfigNameLabel = "openshift.io/deployment-config.name"
+	// On each ReplicationController, the version of the DeploymentConfig it runs
+	deploymentConfigVersionAnnotation = "openshift.io/deployment-config.latest-version"
+	// On each pod, the name of its DeploymentConfig and of its ReplicationController
+	deploymentConfigLabel = "deploymentconfig"
+	deploymentLabel       = "deployment"
+)
+
+// Get pods from the ReplicationController of the latest running version of an OpenShift
+// DeploymentConfig. DeploymentConfigs are found through their ReplicationControllers, which are
+// core resources, so no OpenShift client is needed and other clusters simply have none.
+func (s *Searcher) getPodsFromDeploymentConfig(ctx context.Context, deploymentConfigName string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	controllers, err := retryAPI(ctx, s, opts, func() (*corev1.ReplicationControllerList, error) {
+		return s.client.CoreV1().ReplicationControllers(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{deploymentConfigNameLabel: deploymentConfigName}).String(),
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ReplicationControllers for deploymentconfig '%s': %w", deploymentConfigName, err)
+	}
+	if len(controllers.Items) == 0 {
+		return nil, fmt.Errorf("deploymentconfig '%s' %w in namespace '%s' (it has no ReplicationController; DeploymentConfigs only exist on OpenShift)",
+			deploymentConfigName, ErrResourceNotFound, namespace)
+	}
+
+	// Find the latest version still scaled up: a failed rollout scales its own version down and
+	// the previous one back up
+	var active *corev1.ReplicationController
+	var activeVersion int64
+	for i := range controllers.Items {
+		rc := &controllers.Items[i]
+		if rc.Spec.Replicas != nil && *rc.Spec.Replicas == 0 {
+			continue
+		}
+		version, _ := strconv.ParseInt(rc.Annotations[deploymentConfigVersionAnnotation], 10, 64)
+		if active == nil || version > activeVersion {
+			active, activeVersion = rc, version
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("deploymentconfig '%s' has %w", deploymentConfigName, ErrZeroReplicas)
+	}
+
+	// List the pods of the active ReplicationController
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{deploymentConfigLabel: deploymentConfigName, deploymentLabel: active.Name}).String(),
+			FieldSelector: opts.FieldSelector,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for deploymentconfig '%s': %w", deploymentConfigName, err)
+	}
+
+	// Filter out terminating and non-running pods
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s' (has deletion timestamp, see -include-terminating)\n", pod.Name)
+			continue
+		}
+
+		// Skip pods that are not in Running phase, or fail in strict mode
+		if pod.Status.Phase != corev1.PodRunning && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, "deploymentconfig", deploymentConfigName)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping non-running pod '%s' (phase: %s)\n", pod.Name, pod.Status.Phase)
+			continue
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for deploymentconfig '%s'", ErrNoActivePods, deploymentConfigName)
+	}
+
+	s.warnf(VerbosityDiscovery, "Found %d active pods from ReplicationController '%s' for deploymentconfig '%s'\n",
+		len(activePods), active.Name, deploymentConfigName)
+	return activePods, nil
+}
+
+// IsPodPattern reports whether a pod name is a glob pattern, containing * or ?, matching the pods
+// to search rather than naming one
+func IsPodPattern(podName string) bool {
+	return strings.ContainsAny(podName, "*?")
+}
+
+// Get the pods whose name matches a glob pattern, in the syntax of filepath.Match
+func (s *Searcher) getPodsFromPattern(ctx context.Context, pattern string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pod name pattern '%s': %w", pattern, err)
+	}
+
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{FieldSelector: opts.FieldSelector})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods matching '%s': %w", pattern, err)
+	}
+
+	// Keep the pods whose name matches, then filter out terminating and non-running pods
+	activePods := []corev1.Pod{}
+	matched := 0
+	for _, pod := range pods.Items {
+		if ok, _ := filepath.Match(pattern, pod.Name); !ok {
+			continue
+		}
+		matched++
+
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s' (has deletion timestamp, see -include-terminating)\n", podDisplayName(pod.Namespace, pod.Name, opts))
+			continue
+		}
+
+		// Skip pods that are not in Running phase, or fail in strict mode
+		if pod.Status.Phase != corev1.PodRunning && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, ResourceTypePod, pattern)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping non-running pod '%s' (phase: %s)\n", podDisplayName(pod.Namespace, pod.Name, opts), pod.Status.Phase)
+			continue
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if matched == 0 {
+		where := fmt.Sprintf("in namespace '%s'", namespace)
+		if opts.AllNamespaces {
+			where = "in any namespace"
+		}
+		return nil, fmt.Errorf("pods matching '%s' %w %s", pattern, ErrResourceNotFound, where)
+	}
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for pods matching '%s'", ErrNoActivePods, pattern)
+	}
+	return activePods, nil
+}
+
+// Get pods matching a label selector
+func (s *Searcher) getPodsFromSelector(ctx context.Context, selector string, opts Options) ([]corev1.Pod, error) {
+	namespace := opts.searchNamespace()
+
+	labelSelector, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector '%s': %w", selector, err)
+	}
+
+	// List pods with the selector
+	pods, err := retryAPI(ctx, s, opts, func() (*corev1.PodList, error) {
+		return s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector.String(),
+			FieldSelector: opts.FieldSelector,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods for selector '%s': %w", selector, err)
+	}
+
+	// Filter out terminating and non-running pods
+	activePods := []corev1.Pod{}
+	for _, pod := range pods.Items {
+		// Skip pods that are being deleted
+		if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+			s.warnf(VerbosityDiscovery, "Skipping terminating pod '%s/%s' (has deletion timestamp, see -include-terminating)\n", pod.Namespace, pod.Name)
+			continue
+		}
+
+		// Skip pods that are not in Running phase, or fail in strict mode
+		if pod.Status.Phase != corev1.PodRunning && !opts.IncludeNotRunning {
+			if opts.StrictPods {
+				return nil, notRunningError(pod, "selector", selector)
+			}
+			s.warnf(VerbosityDiscovery, "Skipping non-running pod '%s/%s' (phase: %s)\n", pod.Namespace, pod.Name, pod.Status.Phase)
+			continue
+		}
+
+		activePods = append(activePods, pod)
+	}
+
+	if len(activePods) == 0 {
+		return nil, fmt.Errorf("%w for selector '%s'", ErrNoActivePods, selector)
+	}
+
+	if namespace == metav1.NamespaceAll {
+		s.warnf(VerbosityDiscovery, "Found %d active pods for selector '%s' in all namespaces\n", len(activePods), selector)
+	} else {
+		s.warnf(VerbosityDiscovery, "Found %d active pods for selector '%s'\n", len(activePods), selector)
+	}
+	return activePods, nil
+}
+
+// Error for a pod that isn't running when StrictPods forbids skipping it
+func notRunningError(pod corev1.Pod, resourceType ResourceType, resourceName string) error {
+	return fmt.Errorf("pod '%s' of %s '%s' is not running (phase: %s)",
+		pod.Name, resourceType, resourceName, pod.Status.Phase)
+}
@@ -0,0 +1,118 @@
+package needle
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// jsonCondition tests one field of a JSON log line
+type jsonCondition struct {
+	// Keys leading to the field, e.g. ["error", "code"] for "error.code"
+	path  []string
+	value string
+	// Whether the field must contain value rather than equal it
+	contains bool
+}
+
+// jsonFieldMatcher matches JSON log lines whose fields satisfy every condition
+type jsonFieldMatcher []jsonCondition
+
+// Parse a pattern of comma-separated "field=value" (equals) and "field~value" (contains)
+// conditions, where nested fields are separated by dots
+func newJSONFieldMatcher(pattern string) (jsonFieldMatcher, error) {
+	var conditions jsonFieldMatcher
+	for _, expression := range strings.Split(pattern, ",") {
+		i := strings.IndexAny(expression, "=~")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid JSON field condition '%s': expected field=value or field~value", expression)
+		}
+		field := strings.TrimSpace(expression[:i])
+		if field == "" {
+			return nil, fmt.Errorf("invalid JSON field condition '%s': missing field name", expression)
+		}
+		conditions = append(conditions, jsonCondition{
+			path:     strings.Split(field, "."),
+			value:    expression[i+1:],
+			contains: expression[i] == '~',
+		})
+	}
+	return conditions, nil
+}
+
+// Match reports whether the line is a JSON object satisfying every condition; other lines never match
+func (m jsonFieldMatcher) Match(line string) bool {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return false
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return false
+	}
+
+	for _, condition := range m {
+		value, ok := jsonFieldValue(fields, condition.path)
+		if !ok {
+			return false
+		}
+		if condition.contains && !strings.Contains(value, condition.value) {
+			return false
+		}
+		if !condition.contains && value != condition.value {
+			return false
+		}
+	}
+	return true
+}
+
+// Highlight leaves the line unchanged, since the conditions match it as a whole
+func (m jsonFieldMatcher) Highlight(line, before, after string) string {
+	return line
+}
+
+// Look up a nested field, formatting numbers, booleans and null as they appear in JSON
+func jsonFieldValue(fields map[string]any, path []string) (string, bool) {
+	var value any = fields
+	for _, key := range path {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "null", true
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(encoded), true
+	}
+}
+
+// Check whether a line belongs to the selected output stream, going by the "stream" field of JSON
+// log lines; lines without one are always searched
+func (o Options) onSelectedStream(line string) bool {
+	if o.Stream == "" || o.Stream == StreamBoth {
+		return true
+	}
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return true
+	}
+	var fields struct {
+		Stream *string `json:"stream"`
+	}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil || fields.Stream == nil {
+		return true
+	}
+	return *fields.Stream == string(o.Stream)
+}
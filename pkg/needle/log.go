@@ -0,0 +1,96 @@
+package needle
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Verbosity selects which progress messages a Searcher prints
+type Verbosity int
+
+// Verbosity levels, each including the messages of the lower ones
+const (
+	// VerbosityQuiet prints only errors and output explicitly asked for, such as ShowMatch lines
+	VerbosityQuiet Verbosity = iota
+	// VerbosityDiscovery adds the discovered and skipped pods
+	VerbosityDiscovery
+	// VerbosityMatches adds matches, reconnects and restarts
+	VerbosityMatches
+	// VerbosityLogs adds every log line read
+	VerbosityLogs
+)
+
+// ANSI escapes around highlighted matches, in bold red
+const (
+	ansiHighlight = "\x1b[1;31m"
+	ansiReset     = "\x1b[0m"
+)
+
+// Print a progress message to Stdout when the verbosity reaches level
+func (s *Searcher) logf(level Verbosity, format string, args ...any) {
+	if s.Verbosity >= level {
+		fmt.Fprintf(s.Stdout, format, args...)
+	}
+}
+
+// Report the status of a pod of a resource to Progress
+func (s *Searcher) progress(namespace, podName string, status PodStatus) {
+	if s.Progress != nil {
+		s.Progress(namespace, podName, status)
+	}
+}
+
+// Print a diagnostic message to Stderr when the verbosity reaches level
+func (s *Searcher) warnf(level Verbosity, format string, args ...any) {
+	if s.Verbosity >= level {
+		fmt.Fprintf(s.Stderr, format, args...)
+	}
+}
+
+// podOutput buffers the messages of one pod of a resource search with OrderedOutput, so that
+// they are printed together instead of interleaved with those of the other pods
+type podOutput struct {
+	mu     sync.Mutex
+	chunks []outputChunk
+	// Set once flushed; later messages are printed right away
+	flushed bool
+}
+
+// outputChunk is a message buffered for a writer
+type outputChunk struct {
+	out io.Writer
+	b   []byte
+}
+
+// Writer buffering messages for out until the output is flushed
+func (o *podOutput) writer(out io.Writer) io.Writer {
+	return podOutputWriter{output: o, out: out}
+}
+
+// Print the buffered messages in the order they were written
+func (o *podOutput) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, chunk := range o.chunks {
+		chunk.out.Write(chunk.b)
+	}
+	o.chunks = nil
+	o.flushed = true
+}
+
+// podOutputWriter buffers messages for a writer in a podOutput
+type podOutputWriter struct {
+	output *podOutput
+	out    io.Writer
+}
+
+func (w podOutputWriter) Write(b []byte) (int, error) {
+	w.output.mu.Lock()
+	defer w.output.mu.Unlock()
+	if w.output.flushed {
+		return w.out.Write(b)
+	}
+	w.output.chunks = append(w.output.chunks, outputChunk{out: w.out, b: append([]byte(nil), b...)})
+	return len(b), nil
+}
@@ -0,0 +1,84 @@
+package needle
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matcher tests log lines against one search pattern
+type Matcher interface {
+	// Match reports whether the line, without its Kubernetes timestamp unless
+	// Options.MatchTimestamps is set, matches the pattern
+	Match(line string) bool
+	// Highlight wraps the parts of the line that match the pattern with before and after
+	Highlight(line, before, after string) string
+}
+
+// Build the matcher of a search pattern according to the options
+func newMatcher(pattern string, opts Options) (Matcher, error) {
+	switch {
+	case opts.JSONFields:
+		return newJSONFieldMatcher(pattern)
+	case opts.Regex:
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %w", pattern, err)
+		}
+		if opts.WholeLine {
+			anchored, err := regexp.Compile(`^(?:` + pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression '%s': %w", pattern, err)
+			}
+			return wholeLineMatcher{Matcher: regexMatcher{re}, match: anchored.MatchString}, nil
+		}
+		return regexMatcher{re}, nil
+	case opts.WholeLine:
+		return wholeLineMatcher{Matcher: literalMatcher(pattern), match: func(line string) bool {
+			return line == pattern
+		}}, nil
+	}
+	return literalMatcher(pattern), nil
+}
+
+// literalMatcher matches lines containing a string
+type literalMatcher string
+
+// Match reports whether the line contains the string
+func (m literalMatcher) Match(line string) bool {
+	return strings.Contains(line, string(m))
+}
+
+// Highlight wraps every occurrence of the string
+func (m literalMatcher) Highlight(line, before, after string) string {
+	return strings.ReplaceAll(line, string(m), before+string(m)+after)
+}
+
+// regexMatcher matches lines containing a match of a regular expression
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+// Match reports whether the regular expression matches part of the line
+func (m regexMatcher) Match(line string) bool {
+	return m.re.MatchString(line)
+}
+
+// Highlight wraps every match of the regular expression
+func (m regexMatcher) Highlight(line, before, after string) string {
+	return m.re.ReplaceAllStringFunc(line, func(match string) string {
+		return before + match + after
+	})
+}
+
+// wholeLineMatcher matches lines that, once leading and trailing whitespace (including a trailing
+// \r) is trimmed, are entirely matched by the pattern; the embedded Matcher highlights the match
+type wholeLineMatcher struct {
+	Matcher
+	match func(line string) bool
+}
+
+// Match reports whether the trimmed line is entirely matched by the pattern
+func (m wholeLineMatcher) Match(line string) bool {
+	return m.match(strings.TrimSpace(line))
+}
@@ -0,0 +1,130 @@
+package needle
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Upper bounds in seconds of the search duration histogram buckets
+var searchDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// Search outcomes, used as the result label of klogs_needle_searches_total
+const (
+	searchResultFound    = "found"
+	searchResultNotFound = "not_found"
+	searchResultError    = "error"
+)
+
+// Metrics counts searches, matches and pods searched by a Searcher and serves them in the
+// Prometheus text format. A nil *Metrics records nothing.
+type Metrics struct {
+	mu          sync.Mutex
+	searches    map[string]uint64
+	matches     uint64
+	pods        uint64
+	podTimeouts uint64
+	// Cumulative counts per bucket of searchDurationBuckets, then the sum and count of all durations
+	durationBuckets []uint64
+	durationSum     float64
+	durationCount   uint64
+}
+
+// NewMetrics creates empty metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		searches:        map[string]uint64{searchResultFound: 0, searchResultNotFound: 0, searchResultError: 0},
+		durationBuckets: make([]uint64, len(searchDurationBuckets)),
+	}
+}
+
+// Record the outcome and duration of a search
+func (m *Metrics) observeSearch(result Result, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	outcome := searchResultNotFound
+	switch {
+	case err != nil:
+		outcome = searchResultError
+	case result.Found:
+		outcome = searchResultFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searches[outcome]++
+	seconds := duration.Seconds()
+	for i, bound := range searchDurationBuckets {
+		if seconds <= bound {
+			m.durationBuckets[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// Record a searched pod, whether its logs matched and whether its pod timeout ended the search
+func (m *Metrics) observePod(found, timedOut bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pods++
+	if found {
+		m.matches++
+	}
+	if timedOut {
+		m.podTimeouts++
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var written int64
+	var err error
+	printf := func(format string, args ...any) {
+		if err != nil {
+			return
+		}
+		var n int
+		n, err = fmt.Fprintf(w, format, args...)
+		written += int64(n)
+	}
+
+	printf("# HELP klogs_needle_searches_total Searches completed, by result.\n")
+	printf("# TYPE klogs_needle_searches_total counter\n")
+	for _, outcome := range []string{searchResultFound, searchResultNotFound, searchResultError} {
+		printf("klogs_needle_searches_total{result=%q} %d\n", outcome, m.searches[outcome])
+	}
+	printf("# HELP klogs_needle_matches_total Pods whose logs matched the patterns.\n")
+	printf("# TYPE klogs_needle_matches_total counter\n")
+	printf("klogs_needle_matches_total %d\n", m.matches)
+	printf("# HELP klogs_needle_pods_searched_total Pods whose search ended.\n")
+	printf("# TYPE klogs_needle_pods_searched_total counter\n")
+	printf("klogs_needle_pods_searched_total %d\n", m.pods)
+	printf("# HELP klogs_needle_pod_timeouts_total Pods whose search was ended by the pod timeout.\n")
+	printf("# TYPE klogs_needle_pod_timeouts_total counter\n")
+	printf("klogs_needle_pod_timeouts_total %d\n", m.podTimeouts)
+	printf("# HELP klogs_needle_search_duration_seconds Duration of completed searches.\n")
+	printf("# TYPE klogs_needle_search_duration_seconds histogram\n")
+	for i, bound := range searchDurationBuckets {
+		printf("klogs_needle_search_duration_seconds_bucket{le=\"%g\"} %d\n", bound, m.durationBuckets[i])
+	}
+	printf("klogs_needle_search_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.durationCount)
+	printf("klogs_needle_search_duration_seconds_sum %g\n", m.durationSum)
+	printf("klogs_needle_search_duration_seconds_count %d\n", m.durationCount)
+	return written, err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
@@ -0,0 +1,41 @@
+package needle
+
+import "strings"
+
+// Default byte cap of the window searched by multiline patterns
+const defaultMultilineWindow = 64 * 1024
+
+// multilineWindow holds the most recent lines of a stream, searched by patterns spanning several lines
+type multilineWindow struct {
+	text string
+	max  int
+}
+
+// Append a line, dropping the oldest lines beyond the byte cap; a single longer line keeps its end
+func (w *multilineWindow) add(line string) {
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	w.text += line
+	for len(w.text) > w.max {
+		i := strings.IndexByte(w.text, '\n')
+		if i < 0 || i == len(w.text)-1 {
+			w.text = w.text[len(w.text)-w.max:]
+			return
+		}
+		w.text = w.text[i+1:]
+	}
+}
+
+// Forget the lines a match consumed, so that they don't match again
+func (w *multilineWindow) reset() {
+	w.text = ""
+}
+
+// Byte cap of the multiline window
+func (o Options) multilineWindow() int {
+	if o.MultilineWindow > 0 {
+		return o.MultilineWindow
+	}
+	return defaultMultilineWindow
+}
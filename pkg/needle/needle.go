@@ -0,0 +1,725 @@
+// Package needle searches Kubernetes pod logs for string patterns.
+//
+// It is the engine behind the klogs-needle command and can be embedded in
+// other Go programs, such as integration-test harnesses:
+//
+//	searcher := needle.NewSearcher(clientset)
+//	result, err := searcher.Search(ctx, needle.Options{
+//		DeploymentName: "my-app",
+//		Namespace:      "default",
+//		SearchPatterns: []string{"Service started"},
+//	})
+package needle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	typedappsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	typedauthorizationv1 "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	typedbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// ResourceType represents the type of Kubernetes resource
+type ResourceType string
+
+// Constants for resource types
+const (
+	ResourceTypeDeployment  ResourceType = "deployment"
+	ResourceTypeStatefulSet ResourceType = "statefulset"
+	ResourceTypeDaemonSet   ResourceType = "daemonset"
+	ResourceTypeJob         ResourceType = "job"
+	ResourceTypeCronJob     ResourceType = "cronjob"
+	// ResourceTypeDeploymentConfig is an OpenShift DeploymentConfig
+	ResourceTypeDeploymentConfig ResourceType = "deploymentconfig"
+	ResourceTypeSelector         ResourceType = "selector"
+	// ResourceTypePod names a single pod among Options.Targets
+	ResourceTypePod ResourceType = "pod"
+)
+
+// Target is a pod, workload resource or label selector searched together with the others of
+// Options.Targets
+type Target struct {
+	Type ResourceType
+	Name string
+}
+
+// String describes the target in messages, e.g. "deployment 'web'"
+func (t Target) String() string {
+	return fmt.Sprintf("%s '%s'", t.Type, t.Name)
+}
+
+// Describe several targets in messages, e.g. "deployment 'web' and statefulset 'db'"
+func describeTargets(targets []Target) string {
+	descriptions := make([]string, len(targets))
+	for i, target := range targets {
+		descriptions[i] = target.String()
+	}
+	if len(descriptions) <= 1 {
+		return strings.Join(descriptions, "")
+	}
+	return strings.Join(descriptions[:len(descriptions)-1], ", ") + " and " + descriptions[len(descriptions)-1]
+}
+
+// CountScope defines where matches are counted towards Options.Count
+type CountScope string
+
+// Constants for count scopes
+const (
+	CountScopePod   CountScope = "pod"
+	CountScopeTotal CountScope = "total"
+)
+
+// Requirement defines how many pods of a resource must match
+type Requirement string
+
+// Constants for requirements
+const (
+	RequireAll Requirement = "all"
+	RequireAny Requirement = "any"
+)
+
+// MatchMode defines how multiple search patterns combine
+type MatchMode string
+
+// Constants for match modes
+const (
+	MatchModeAny MatchMode = "any"
+	MatchModeAll MatchMode = "all"
+)
+
+// LogStream selects the container output stream whose lines are searched
+type LogStream string
+
+// Constants for log streams
+const (
+	StreamBoth   LogStream = "both"
+	StreamStdout LogStream = "stdout"
+	StreamStderr LogStream = "stderr"
+)
+
+// Options describes what to search and how
+type Options struct {
+	// Exactly one of PodName, a resource name or LabelSelector selects the pods to search; a CronJob is
+	// resolved to the most recent Job it created
+	PodName         string
+	DeploymentName  string
+	StatefulSetName string
+	DaemonSetName   string
+	JobName         string
+	CronJobName     string
+	// DeploymentConfigName is an OpenShift DeploymentConfig, resolved through the
+	// ReplicationController of its latest running version
+	DeploymentConfigName string
+	// LabelSelector selects pods directly by label, e.g. "app=foo,tier=web"
+	LabelSelector string
+	// Targets searches the pods of several pods, resources and label selectors at once instead of
+	// the single pod or resource above. A pod selected by several targets is searched once, and
+	// Require applies to the combined pods: RequireAll needs every pod of every target to match.
+	// WatchPods can't be used with Targets.
+	Targets []Target
+	// FieldSelector narrows the pods of a resource or label selector at the API server, e.g.
+	// "status.phase=Running,spec.nodeName=node-1"
+	FieldSelector string
+	// Require sets whether every pod of a resource (the default) or any one of them must match
+	Require Requirement
+	// StrictPods fails the search when a selected pod of the resource isn't running, or for a Job
+	// hasn't completed either, instead of skipping it
+	StrictPods bool
+	// IncludeTerminating searches pods being deleted instead of skipping them, until their logs end
+	IncludeTerminating bool
+	// IncludeNotRunning searches the logs available from pods that aren't running, e.g. Failed or
+	// Pending pods, reading them to their end, instead of skipping them
+	IncludeNotRunning bool
+	// OrderedOutput buffers the messages of each pod of a resource search and prints them grouped
+	// by pod, in discovery order, when the search ends instead of interleaving them live
+	OrderedOutput bool
+	// LenientOwner searches every pod matching a deployment's selector when no ReplicaSet owned
+	// by the deployment is found, e.g. for pods adopted without owner references
+	LenientOwner bool
+	// WatchPods adds pods of the resource that start during the search; with RequireAll they must
+	// match too, and the search is only found once the resource runs all its desired pods on its
+	// latest template, or at the timeout
+	WatchPods bool
+
+	Namespace string
+	// AllNamespaces looks up the pod or the label selector's pods in every namespace
+	AllNamespaces bool
+	// NamespaceSelector searches the resource or label selector in every namespace whose labels
+	// match this selector, e.g. team=payments, instead of Namespace
+	NamespaceSelector string
+	ContainerName     string
+	// DefaultFirstContainer searches the first container of a pod with several containers when
+	// ContainerName is empty, instead of failing with ErrMultipleContainers
+	DefaultFirstContainer bool
+	// Containers searches exactly these containers of each pod concurrently, matching if any of
+	// them matches; every one of them must exist
+	Containers []string
+	// AllContainers searches every container of each pod, including ephemeral debug containers,
+	// matching if any of them matches
+	AllContainers bool
+	// InitContainers also searches the init containers of each pod, whose logs are read to the end
+	InitContainers bool
+
+	// SearchPatterns are combined according to MatchMode (defaults to any)
+	SearchPatterns []string
+	MatchMode      MatchMode
+	Regex          bool
+	// WholeLine requires the whole line, without leading and trailing whitespace such as a trailing
+	// \r, to equal the pattern, or with Regex to fully match it
+	WholeLine bool
+	// JSONFields reads each search pattern as comma-separated conditions on the fields of JSON log
+	// lines, "field=value" for equality or "field~value" for a substring, e.g. "level=error,msg~timeout";
+	// all of a pattern's conditions must hold on the same line, and lines that aren't JSON never match
+	JSONFields bool
+	// Multiline tests the patterns against a window of the most recent lines instead of each line,
+	// so that a regular expression like "Caused by(?s).*TimeoutException" can span lines. The window
+	// holds at most MultilineWindow bytes (64 KiB by default) and is emptied by every match.
+	Multiline       bool
+	MultilineWindow int
+	// Stream only searches the lines written to stdout or stderr (defaults to both), going by the
+	// "stream" field of JSON log lines as written by CRI log formats; lines without one are
+	// always searched
+	Stream LogStream
+	// Count is how many times a pattern must appear to be found (defaults to 1), counted in
+	// each pod or, with CountScopeTotal, across all pods of the resource
+	Count      int
+	CountScope CountScope
+
+	// Since and TailLines bound how much log history is searched; zero and nil search all of it
+	Since     time.Duration
+	TailLines *int64
+	// FromStart requests the logs since the pod was created, so lines logged before the search
+	// connected are read even where the runtime would otherwise start near the tail; the time of
+	// the earliest line read is reported with Timestamps
+	FromStart bool
+	// LimitBytes caps the log bytes read from each pod or container, across reopened streams; a pod
+	// whose logs reach it without a match is not found. Zero means no limit.
+	LimitBytes int64
+	// MaxLogLines caps the lines read from each log stream; a pod whose stream reaches it without a
+	// match is not found and no longer streamed. Zero means no limit.
+	MaxLogLines int
+	// TailThenFollow reads the log history bounded by Since and TailLines to its end, then follows
+	// the lines logged since it was requested, printing a marker at the boundary; a match in the
+	// history ends the search before anything is followed
+	TailThenFollow bool
+	// Previous searches the last terminated instance of the container, reading its logs to the end
+	Previous bool
+	// SearchPreviousOnRestart first reads the logs of the previous instance of a container that
+	// restarted before the search, then follows the current one; matches in both count together
+	SearchPreviousOnRestart bool
+	// WaitForReady waits, within the search, for the searched container to be ready before its logs
+	// are streamed, instead of failing when it hasn't started yet
+	WaitForReady bool
+	// NoFollow only searches the logs available when the search starts
+	NoFollow bool
+	// Timestamps prefixes every log line with its RFC3339 timestamp from Kubernetes; the patterns
+	// are tested against the line without it unless MatchTimestamps is set
+	Timestamps      bool
+	MatchTimestamps bool
+	// Within, with Timestamps, only counts matches on lines whose timestamp is at most this long
+	// before they are read; lines without a parseable timestamp never count
+	Within time.Duration
+
+	// ShowMatch prints each matching line with its line number in the stream, surrounded by
+	// BeforeLines and AfterLines lines of context
+	ShowMatch   bool
+	BeforeLines int
+	AfterLines  int
+	// Dedup prints a run of identical shown or debug lines once, followed by the line with its
+	// repeat count when the run ends; it doesn't change how matches are counted
+	Dedup bool
+
+	// Debug prints every log line read, like a Searcher with VerbosityLogs
+	Debug           bool
+	DiagnoseOnError bool
+	ResetOnRestart  bool
+	// MaxRetries caps how often a pod discovery API call failing with a transient error (a timeout,
+	// throttling or a server error) is retried, with exponential backoff; zero disables retries
+	MaxRetries int
+	// MaxReconnects caps how often a log stream closed while its container keeps running is reopened
+	MaxReconnects int
+	ReadTimeout   time.Duration
+	// PodTimeout caps the search of each pod, which then counts as not found; zero leaves every
+	// pod the whole search
+	PodTimeout time.Duration
+	// Concurrency caps how many pods of a resource are searched at once; zero means no limit
+	Concurrency int
+	// KeepGoing keeps searching the other pods of a resource after one failed or ended without a
+	// match with RequireAll, so the error tally covers every pod, instead of stopping right away
+	KeepGoing bool
+	ScanFull  bool
+	// StreamMatches prints every line matching any pattern as it is read, prefixed by its pod, and
+	// searches each pod until its logs end or the search ends instead of stopping at a match. A pod,
+	// and the search, is found once any line matched; Count and MatchModeAll don't apply.
+	StreamMatches bool
+	Invert        bool
+
+	// Matcher of each search pattern, set by Compile
+	matchers []Matcher
+	// Set when the options target an init container
+	initContainer bool
+	// Set when the options target an ephemeral container
+	ephemeralContainer bool
+	// Set when the searched pod has completed, so its logs end instead of being followed
+	podCompleted bool
+	// Match counts shared by all pods with CountScopeTotal
+	totalCounts []int32
+	// Lines of the searched pod matched with StreamMatches
+	streamed *streamedMatches
+}
+
+// PodSearchResult stores the result of searching a single pod
+type PodSearchResult struct {
+	PodName   string
+	Namespace string
+	Found     bool
+	// Container is the container whose logs matched, e.g. the winning one with AllContainers
+	Container string
+	// MatchedLine is the log line that completed the match, LineNumber its 1-based number in the
+	// log stream it was read from and MatchedAt the time it was read
+	MatchedLine string
+	LineNumber  int
+	MatchedAt   time.Time
+	Error       error
+	Diagnostic  *PodDiagnostic
+	// TimedOut is set when the pod or search timeout ended the search of the pod before a match
+	TimedOut bool
+	// Target is the pod or resource the pod was searched for; with Options.Targets, the first of
+	// them that selected it
+	Target Target
+	// Matches counts the matching lines printed with StreamMatches
+	Matches int
+}
+
+// PodStatus is the search state of a pod of a resource, reported to Searcher.Progress
+type PodStatus string
+
+// Pod search states
+const (
+	PodSearching PodStatus = "searching"
+	PodMatched   PodStatus = "matched"
+	PodNoMatch   PodStatus = "no match"
+	PodErrored   PodStatus = "error"
+	PodTimedOut  PodStatus = "timed out"
+	// PodStopped marks a pod whose search ended early because the outcome was decided
+	PodStopped PodStatus = "stopped"
+)
+
+// Status of a pod that reported its result
+func (r PodSearchResult) Status() PodStatus {
+	switch {
+	case r.Error != nil:
+		return PodErrored
+	case r.Found:
+		return PodMatched
+	case r.TimedOut:
+		return PodTimedOut
+	}
+	return PodNoMatch
+}
+
+// Result is the outcome of a search
+type Result struct {
+	// Found reports whether the search condition was met: the pattern was found in the pod,
+	// in all pods of the resource, or (with RequireAny, ScanFull or Invert) in at least one of them
+	Found bool
+	// Pods holds the per-pod outcomes; pods still searching when the search ended are not found
+	Pods []PodSearchResult
+}
+
+// MatchedPods returns the names of the pods whose logs matched
+func (r Result) MatchedPods() []string {
+	var matched []string
+	for _, pod := range r.Pods {
+		if pod.Found {
+			matched = append(matched, pod.PodName)
+		}
+	}
+	return matched
+}
+
+// FirstMatch returns the pod whose logs matched first, if any
+func (r Result) FirstMatch() (PodSearchResult, bool) {
+	var first PodSearchResult
+	found := false
+	for _, pod := range r.Pods {
+		if pod.Found && (!found || pod.MatchedAt.Before(first.MatchedAt)) {
+			first, found = pod, true
+		}
+	}
+	return first, found
+}
+
+// Summary counts the outcomes of the searched pods
+type Summary struct {
+	Pods     int
+	Matched  int
+	Errored  int
+	TimedOut int
+}
+
+// Summary counts the pods that matched, failed with an error or reached a timeout
+func (r Result) Summary() Summary {
+	summary := Summary{Pods: len(r.Pods)}
+	for _, pod := range r.Pods {
+		switch {
+		case pod.Found:
+			summary.Matched++
+		case pod.Error != nil:
+			summary.Errored++
+		case pod.TimedOut:
+			summary.TimedOut++
+		}
+	}
+	return summary
+}
+
+// Client is the subset of the Kubernetes API used by the Searcher. It is satisfied by
+// *kubernetes.Clientset as well as the fake clientset from k8s.io/client-go/kubernetes/fake.
+type Client interface {
+	CoreV1() typedcorev1.CoreV1Interface
+	AppsV1() typedappsv1.AppsV1Interface
+	BatchV1() typedbatchv1.BatchV1Interface
+	AuthorizationV1() typedauthorizationv1.AuthorizationV1Interface
+}
+
+// logStreamFunc opens a pod log stream; it is replaced in tests to inject log content
+type logStreamFunc func(ctx context.Context, client Client, namespace, podName string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error)
+
+// Searcher searches pod logs using a Kubernetes client
+type Searcher struct {
+	client     Client
+	streamLogs logStreamFunc
+
+	// StreamClient, when set, opens the long-running log streams and watches instead of the
+	// client, e.g. a client without a request timeout
+	StreamClient Client
+
+	// Stdout receives match events, shown matches and debug output, Stderr receives pod discovery,
+	// skipped pods and per-pod errors
+	Stdout io.Writer
+	Stderr io.Writer
+	// Verbosity selects the progress messages printed, VerbosityMatches by default
+	Verbosity Verbosity
+	// Color highlights the matches in shown and debug log lines with ANSI escapes
+	Color bool
+	// Metrics, when set, records every search and searched pod
+	Metrics *Metrics
+	// MatchOutput, when set, receives every matching line with a time, pod and container prefix.
+	// Pods are searched concurrently, so it must be safe for concurrent writes.
+	MatchOutput io.Writer
+	// Progress, when set, is called as each pod of a resource starts being searched and as its
+	// status changes. Calls come from the goroutine running the search, one at a time.
+	Progress func(namespace, podName string, status PodStatus)
+}
+
+// NewSearcher creates a Searcher that writes its output to the process's stdout and stderr
+func NewSearcher(client Client) *Searcher {
+	return &Searcher{
+		client:     client,
+		streamLogs: streamPodLogs,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+		Verbosity:  VerbosityMatches,
+	}
+}
+
+// Client for log streams and watches
+func (s *Searcher) streamClient() Client {
+	if s.StreamClient != nil {
+		return s.StreamClient
+	}
+	return s.client
+}
+
+// Open a pod log stream through the API server
+func streamPodLogs(ctx context.Context, client Client, namespace, podName string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+	return client.CoreV1().Pods(namespace).GetLogs(podName, logOptions).Stream(ctx)
+}
+
+// Search looks for the patterns in the logs of the targeted pod or resource until they are
+// found or ctx is done. Reaching the end of ctx without a match is not an error.
+func (s *Searcher) Search(ctx context.Context, opts Options) (Result, error) {
+	start := time.Now()
+	result, err := s.search(ctx, opts)
+	s.Metrics.observeSearch(result, err, time.Since(start))
+	return result, err
+}
+
+// Search the targeted pod or resource with defaulted options
+func (s *Searcher) search(ctx context.Context, opts Options) (Result, error) {
+	if len(opts.SearchPatterns) == 0 {
+		return Result{}, fmt.Errorf("at least one search pattern is required")
+	}
+	if opts.Debug && s.Verbosity < VerbosityLogs {
+		debug := *s
+		debug.Verbosity = VerbosityLogs
+		s = &debug
+	}
+	if opts.MatchMode == "" {
+		opts.MatchMode = MatchModeAny
+	}
+	if opts.Require == "" {
+		opts.Require = RequireAll
+	}
+	if opts.matchers == nil {
+		if err := opts.Compile(); err != nil {
+			return Result{}, err
+		}
+	}
+
+	if len(opts.Targets) > 0 {
+		// Search in the combined pods of several targets
+		return s.searchTargets(ctx, opts)
+	}
+	if opts.NamespaceSelector != "" {
+		// Search in the resource's pods of every selected namespace
+		return s.searchSelectedNamespaces(ctx, opts)
+	}
+	if IsPodPattern(opts.PodName) {
+		// Search in every pod whose name matches, like in the pods of a resource
+		return s.searchResourcePodLogs(ctx, ResourceTypePod, opts.PodName, opts)
+	}
+	if opts.PodName != "" {
+		if opts.AllNamespaces {
+			// Search the pod in the namespace it was found in
+			pod, err := s.findPodInAllNamespaces(ctx, opts.PodName, opts)
+			if err != nil {
+				return Result{}, err
+			}
+			opts.Namespace = pod.Namespace
+		}
+
+		// Search in a single pod
+		match, err := s.searchPodWithTimeout(ctx, opts.PodName, opts)
+		podResult := PodSearchResult{
+			PodName:     opts.PodName,
+			Namespace:   opts.Namespace,
+			Found:       match.found,
+			Container:   match.container,
+			MatchedLine: match.line,
+			LineNumber:  match.lineNumber,
+			MatchedAt:   match.matchedAt,
+			Error:       err,
+			TimedOut:    match.timedOut,
+			Target:      Target{Type: ResourceTypePod, Name: opts.PodName},
+		}
+		if err != nil && opts.DiagnoseOnError {
+			podResult.Diagnostic = s.collectDiagnostic(opts.PodName, opts)
+		}
+		return Result{Found: match.found, Pods: []PodSearchResult{podResult}}, err
+	}
+	if resourceType, resourceName := opts.Resource(); resourceType != "" {
+		// Search in all pods of the resource
+		return s.searchResourcePodLogs(ctx, resourceType, resourceName, opts)
+	}
+	return Result{}, fmt.Errorf("either a pod name, a deployment, statefulset, daemonset, job, cronjob or deploymentconfig name, or a label selector is required")
+}
+
+// Resource returns the type and name of the targeted workload resource, or the label selector,
+// or an empty type when none is set
+func (o Options) Resource() (ResourceType, string) {
+	switch {
+	case o.DeploymentName != "":
+		return ResourceTypeDeployment, o.DeploymentName
+	case o.StatefulSetName != "":
+		return ResourceTypeStatefulSet, o.StatefulSetName
+	case o.DaemonSetName != "":
+		return ResourceTypeDaemonSet, o.DaemonSetName
+	case o.JobName != "":
+		return ResourceTypeJob, o.JobName
+	case o.CronJobName != "":
+		return ResourceTypeCronJob, o.CronJobName
+	case o.DeploymentConfigName != "":
+		return ResourceTypeDeploymentConfig, o.DeploymentConfigName
+	case o.LabelSelector != "":
+		return ResourceTypeSelector, o.LabelSelector
+	}
+	return "", ""
+}
+
+// Namespace in which pods are discovered, empty for all namespaces
+func (o Options) searchNamespace() string {
+	if o.AllNamespaces {
+		return metav1.NamespaceAll
+	}
+	return o.Namespace
+}
+
+// Check whether the searched pods may live in several namespaces
+func (o Options) spansNamespaces() bool {
+	return o.AllNamespaces || o.NamespaceSelector != ""
+}
+
+// Check whether several containers of each pod are searched
+func (o Options) searchesSeveralContainers() bool {
+	return o.AllContainers || o.InitContainers || len(o.Containers) > 0
+}
+
+// Compile builds the Matcher of each search pattern, so that invalid regular expressions or JSON
+// field conditions can be reported before any Kubernetes call is made
+func (o *Options) Compile() error {
+	if o.Regex && o.JSONFields {
+		return fmt.Errorf("JSON field conditions can't be regular expressions")
+	}
+	if o.WholeLine && (o.JSONFields || o.Multiline) {
+		return fmt.Errorf("whole-line matching can't be combined with JSON field conditions or multiline matching")
+	}
+	switch o.Stream {
+	case "", StreamBoth, StreamStdout, StreamStderr:
+	default:
+		return fmt.Errorf("stream must be '%s', '%s' or '%s'", StreamStdout, StreamStderr, StreamBoth)
+	}
+
+	o.matchers = nil
+	for _, pattern := range o.SearchPatterns {
+		matcher, err := newMatcher(pattern, *o)
+		if err != nil {
+			return err
+		}
+		o.matchers = append(o.matchers, matcher)
+	}
+	return nil
+}
+
+// Matchers of the search patterns, built as literal or whole-line matchers when Compile was not called
+func (o Options) patternMatchers() []Matcher {
+	if o.matchers != nil || o.Regex || o.JSONFields {
+		return o.matchers
+	}
+	matchers := make([]Matcher, len(o.SearchPatterns))
+	for i, pattern := range o.SearchPatterns {
+		// Literal patterns always build
+		matchers[i], _ = newMatcher(pattern, o)
+	}
+	return matchers
+}
+
+// MatchLine returns the indexes of the search patterns matching the line, none for a line of
+// the output stream not selected by Stream
+func (o Options) MatchLine(line string) []int {
+	text := o.matchText(line)
+	if !o.onSelectedStream(text) {
+		return nil
+	}
+	return o.matchPatterns(text)
+}
+
+// Indexes of the search patterns matching text, a line or with Multiline a window of lines
+func (o Options) matchPatterns(text string) []int {
+	var matched []int
+	for i, matcher := range o.patternMatchers() {
+		if matcher.Match(text) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+// HighlightMatches wraps every match of the search patterns in the line with before and after
+func (o Options) HighlightMatches(line, before, after string) string {
+	for _, matcher := range o.patternMatchers() {
+		line = matcher.Highlight(line, before, after)
+	}
+	return line
+}
+
+// Part of a log line the search patterns are tested against: without its line ending, including
+// the \r of a CRLF, and without the Kubernetes timestamp unless MatchTimestamps is set
+func (o Options) matchText(line string) string {
+	line = strings.TrimRight(line, "\r\n")
+	if !o.Timestamps || o.MatchTimestamps {
+		return line
+	}
+	if _, rest, ok := splitTimestamp(line); ok {
+		return rest
+	}
+	return line
+}
+
+// Check whether a line is recent enough to count with Within
+func (o Options) withinWindow(line string, now time.Time) bool {
+	if o.Within <= 0 {
+		return true
+	}
+	timestamp, _, ok := splitTimestamp(line)
+	return ok && now.Sub(timestamp) <= o.Within
+}
+
+// Split the Kubernetes RFC3339 timestamp from the start of a log line
+func splitTimestamp(line string) (time.Time, string, bool) {
+	prefix, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return time.Time{}, line, false
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, prefix)
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return timestamp, rest, true
+}
+
+// Number of matches needed for a pattern to be found
+func (o Options) countThreshold() int {
+	if o.Count < 1 {
+		return 1
+	}
+	return o.Count
+}
+
+// Record a match of pattern i, returning its new count, or zero when it already reached the threshold
+func (o Options) recordMatch(counts []int, i int) int {
+	threshold := o.countThreshold()
+	if o.totalCounts != nil {
+		if int(atomic.LoadInt32(&o.totalCounts[i])) >= threshold {
+			return 0
+		}
+		return int(atomic.AddInt32(&o.totalCounts[i], 1))
+	}
+	if counts[i] >= threshold {
+		return 0
+	}
+	counts[i]++
+	return counts[i]
+}
+
+// Report which patterns reached the count threshold
+func (o Options) patternsFound(counts []int) []bool {
+	threshold := o.countThreshold()
+	found := make([]bool, len(counts))
+	for i := range counts {
+		if o.totalCounts != nil {
+			found[i] = int(atomic.LoadInt32(&o.totalCounts[i])) >= threshold
+		} else {
+			found[i] = counts[i] >= threshold
+		}
+	}
+	return found
+}
+
+// Check whether a single pod's match decides the whole search
+func (o Options) anyPodDecides() bool {
+	return o.Require == RequireAny || o.Invert || o.ScanFull || o.StreamMatches || o.totalCounts != nil
+}
+
+// Check whether the patterns seen so far satisfy the match mode
+func patternsSatisfied(seen []bool, mode MatchMode) bool {
+	for _, ok := range seen {
+		if ok && mode == MatchModeAny {
+			return true
+		}
+		if !ok && mode == MatchModeAll {
+			return false
+		}
+	}
+	return mode == MatchModeAll
+}
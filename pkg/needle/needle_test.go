@@ -0,0 +1,2507 @@
+package needle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// followReader serves the given logs, then blocks like a followed stream until the context is done
+type followReader struct {
+	ctx  context.Context
+	logs io.Reader
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	n, err := r.logs.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+	if n > 0 {
+		return n, nil
+	}
+	<-r.ctx.Done()
+	return 0, io.EOF
+}
+
+// Create a searcher backed by the fake clientset holding objects, streaming the given logs
+// for every pod (followed streams stay open until the context is done)
+func newTestSearcher(logs string, objects ...runtime.Object) *Searcher {
+	client := fake.NewClientset(objects...)
+
+	searcher := NewSearcher(client)
+	searcher.Stdout = io.Discard
+	searcher.Stderr = io.Discard
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		if !logOptions.Follow {
+			return io.NopCloser(strings.NewReader(logs)), nil
+		}
+		return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader(logs)}), nil
+	}
+	return searcher
+}
+
+// Build a pod in the given phase with the given containers
+func newTestPod(name string, phase corev1.PodPhase, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+	}
+	return pod
+}
+
+// Build a pod that is still running its init container
+func newTestInitPod(name, initContainer string) *corev1.Pod {
+	pod := newTestPod(name, corev1.PodPending, "app")
+	pod.Spec.InitContainers = []corev1.Container{{Name: initContainer}}
+	return pod
+}
+
+func TestSearchSinglePod(t *testing.T) {
+	logs := "starting up\nconnecting to database\nService started on port 8080\n"
+
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		patterns  []string
+		matchMode MatchMode
+		regex     bool
+		all       bool
+		init      bool
+		listed    []string
+		count     int
+		wantFound bool
+		wantErr   string
+	}{
+		{
+			name:      "literal match",
+			pod:       newTestPod("app", corev1.PodRunning, "app"),
+			patterns:  []string{"Service started"},
+			wantFound: true,
+		},
+		{
+			name:     "no match",
+			pod:      newTestPod("app", corev1.PodRunning, "app"),
+			patterns: []string{"Service stopped"},
+		},
+		{
+			name:      "regex match",
+			pod:       newTestPod("app", corev1.PodRunning, "app"),
+			patterns:  []string{`port \d+`},
+			regex:     true,
+			wantFound: true,
+		},
+		{
+			name:      "all patterns on separate lines",
+			pod:       newTestPod("app", corev1.PodRunning, "app"),
+			patterns:  []string{"connecting", "Service started"},
+			matchMode: MatchModeAll,
+			wantFound: true,
+		},
+		{
+			name:      "all patterns with one missing",
+			pod:       newTestPod("app", corev1.PodRunning, "app"),
+			patterns:  []string{"connecting", "ready"},
+			matchMode: MatchModeAll,
+		},
+		{
+			name:      "count reached",
+			pod:       newTestPod("app", corev1.PodRunning, "app"),
+			patterns:  []string{"start"},
+			count:     2,
+			wantFound: true,
+		},
+		{
+			name:     "count not reached",
+			pod:      newTestPod("app", corev1.PodRunning, "app"),
+			patterns: []string{"start"},
+			count:    3,
+		},
+		{
+			name:     "pod not running",
+			pod:      newTestPod("app", corev1.PodPending, "app"),
+			patterns: []string{"Service started"},
+			wantErr:  "is not running",
+		},
+		{
+			name:     "multiple containers without container name",
+			pod:      newTestPod("app", corev1.PodRunning, "app", "sidecar"),
+			patterns: []string{"Service started"},
+			wantErr:  "multiple containers",
+		},
+		{
+			name:      "multiple containers with all containers",
+			pod:       newTestPod("app", corev1.PodRunning, "app", "sidecar"),
+			patterns:  []string{"Service started"},
+			all:       true,
+			wantFound: true,
+		},
+		{
+			name:      "listed containers",
+			pod:       newTestPod("app", corev1.PodRunning, "app", "proxy", "sidecar"),
+			patterns:  []string{"Service started"},
+			listed:    []string{"app", "proxy"},
+			wantFound: true,
+		},
+		{
+			name:     "listed container missing",
+			pod:      newTestPod("app", corev1.PodRunning, "app", "proxy"),
+			patterns: []string{"Service started"},
+			listed:   []string{"app", "cache"},
+			wantErr:  "container(s) 'cache' not found in pod 'app' (containers: app, proxy)",
+		},
+		{
+			name:      "init containers",
+			pod:       newTestInitPod("app", "migrate"),
+			patterns:  []string{"Service started"},
+			init:      true,
+			wantFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher(logs, tt.pod)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			result, err := searcher.Search(ctx, Options{
+				PodName:        tt.pod.Name,
+				Namespace:      "default",
+				SearchPatterns: tt.patterns,
+				MatchMode:      tt.matchMode,
+				Regex:          tt.regex,
+				AllContainers:  tt.all,
+				InitContainers: tt.init,
+				Containers:     tt.listed,
+				Count:          tt.count,
+			})
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestSearchEphemeralContainers(t *testing.T) {
+	pod := newTestPod("app", corev1.PodRunning, "app")
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}},
+	}
+	searcher := newTestSearcher("", pod)
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		logs := "starting up\n"
+		if logOptions.Container == "debugger" {
+			logs = "heap dump written\n"
+		}
+		return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader(logs)}), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := searcher.Search(ctx, Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"heap dump"},
+		AllContainers:  true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Errorf("found = false, want the ephemeral container searched")
+	}
+}
+
+func TestSearchLimitBytes(t *testing.T) {
+	logs := "starting up\nconnecting to database\nService started on port 8080\n"
+	for _, tt := range []struct {
+		limit     int64
+		wantFound bool
+	}{
+		{limit: 0, wantFound: true},
+		{limit: 24, wantFound: false},
+		{limit: int64(len(logs)), wantFound: true},
+	} {
+		searcher := newTestSearcher(logs, newTestPod("app", corev1.PodRunning, "app"))
+		var requested *int64
+		searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+			requested = logOptions.LimitBytes
+			return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader(logs)}), nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		result, err := searcher.Search(ctx, Options{
+			PodName:        "app",
+			Namespace:      "default",
+			SearchPatterns: []string{"Service started"},
+			LimitBytes:     tt.limit,
+		})
+		stopped := ctx.Err() == nil
+		cancel()
+		if err != nil {
+			t.Fatalf("limit %d: unexpected error: %v", tt.limit, err)
+		}
+		if result.Found != tt.wantFound {
+			t.Errorf("limit %d: found = %v, want %v", tt.limit, result.Found, tt.wantFound)
+		}
+		if !stopped {
+			t.Errorf("limit %d: search ran until the timeout", tt.limit)
+		}
+		if tt.limit > 0 && (requested == nil || *requested != tt.limit) {
+			t.Errorf("limit %d: requested LimitBytes = %v", tt.limit, requested)
+		}
+	}
+}
+
+func TestSearchMaxLogLines(t *testing.T) {
+	logs := "starting up\nconnecting to database\nService started on port 8080\n"
+	for _, tt := range []struct {
+		limit     int
+		wantFound bool
+	}{
+		{limit: 0, wantFound: true},
+		{limit: 2, wantFound: false},
+		{limit: 3, wantFound: true},
+	} {
+		searcher := newTestSearcher(logs, newTestPod("app", corev1.PodRunning, "app"))
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		result, err := searcher.Search(ctx, Options{
+			PodName:        "app",
+			Namespace:      "default",
+			SearchPatterns: []string{"Service started"},
+			MaxLogLines:    tt.limit,
+		})
+		// The followed stream never ends, so only a match or the cap stops the search early
+		stopped := ctx.Err() == nil
+		cancel()
+		if err != nil {
+			t.Fatalf("limit %d: unexpected error: %v", tt.limit, err)
+		}
+		if result.Found != tt.wantFound {
+			t.Errorf("limit %d: found = %v, want %v", tt.limit, result.Found, tt.wantFound)
+		}
+		if !stopped {
+			t.Errorf("limit %d: search ran until the timeout", tt.limit)
+		}
+	}
+}
+
+func TestSearchPreviousLogsEndAtEOF(t *testing.T) {
+	pod := newTestPod("app", corev1.PodRunning, "app")
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", RestartCount: 1}}
+	searcher := newTestSearcher("starting up\npanic: out of memory\n", pod)
+
+	// The search must finish at the end of the logs, long before the timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		Previous:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Found {
+		t.Errorf("found = true, want false")
+	}
+	if ctx.Err() != nil {
+		t.Errorf("search ran until the timeout instead of stopping at EOF")
+	}
+}
+
+func TestSearchTailThenFollow(t *testing.T) {
+	tail := int64(2)
+	for _, tt := range []struct {
+		name       string
+		history    string
+		wantFollow bool
+	}{
+		{name: "match in history", history: "starting up\nService started\n", wantFollow: false},
+		{name: "match after history", history: "starting up\nconnecting\n", wantFollow: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher("", newTestPod("app", corev1.PodRunning, "app"))
+			var stdout bytes.Buffer
+			searcher.Stdout = &stdout
+			var requests []corev1.PodLogOptions
+			searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+				requests = append(requests, *logOptions)
+				if !logOptions.Follow {
+					return io.NopCloser(strings.NewReader(tt.history)), nil
+				}
+				return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader("Service started\n")}), nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			result, err := searcher.Search(ctx, Options{
+				PodName:        "app",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				TailLines:      &tail,
+				TailThenFollow: true,
+				ShowMatch:      true,
+			})
+			if err != nil || !result.Found {
+				t.Fatalf("found = %v, err = %v; want found", result.Found, err)
+			}
+
+			if requests[0].Follow || requests[0].TailLines == nil || *requests[0].TailLines != tail {
+				t.Errorf("history request = %+v, want the tail without following", requests[0])
+			}
+			if followed := len(requests) == 2; followed != tt.wantFollow {
+				t.Fatalf("followed = %v, want %v", followed, tt.wantFollow)
+			}
+			if !tt.wantFollow {
+				return
+			}
+			if !requests[1].Follow || requests[1].TailLines != nil || requests[1].SinceTime == nil {
+				t.Errorf("follow request = %+v, want new lines since the history", requests[1])
+			}
+			want := "--- End of log history of pod 'app', following new lines ---\napp:L1: Service started"
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("output missing the boundary marker before the live match:\n%s", stdout.String())
+			}
+		})
+	}
+}
+
+func TestSearchPreviousOnRestart(t *testing.T) {
+	pod := newTestPod("app", corev1.PodRunning, "app")
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", RestartCount: 2}}
+
+	for _, searchPrevious := range []bool{false, true} {
+		searcher := newTestSearcher("", pod)
+		var stderr bytes.Buffer
+		searcher.Stderr = &stderr
+		searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+			if logOptions.Previous {
+				return io.NopCloser(strings.NewReader("Service started\n")), nil
+			}
+			return io.NopCloser(strings.NewReader("panic: crashed again\n")), nil
+		}
+
+		result, err := searcher.Search(context.Background(), Options{
+			PodName:                 "app",
+			Namespace:               "default",
+			SearchPatterns:          []string{"Service started"},
+			NoFollow:                true,
+			SearchPreviousOnRestart: searchPrevious,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Found != searchPrevious {
+			t.Errorf("searchPrevious %v: found = %v", searchPrevious, result.Found)
+		}
+		if warned := strings.Contains(stderr.String(), "has restarted (restarts: 2)"); warned == searchPrevious {
+			t.Errorf("searchPrevious %v: warning printed = %v:\n%s", searchPrevious, warned, stderr.String())
+		}
+	}
+}
+
+func TestSearchEmptyLogsEndWithoutError(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "follow"},
+		{name: "no follow", opts: Options{NoFollow: true}},
+		{name: "previous", opts: Options{Previous: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The container wrote nothing and its stream ends at once, even when followed
+			pod := newTestPod("app", corev1.PodRunning, "app")
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", RestartCount: 1}}
+			searcher := newTestSearcher("", pod)
+			searcher.streamLogs = func(context.Context, Client, string, string, *corev1.PodLogOptions) (io.ReadCloser, error) {
+				return io.NopCloser(strings.NewReader("")), nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			opts := tt.opts
+			opts.PodName = "app"
+			opts.Namespace = "default"
+			opts.SearchPatterns = []string{"Service started"}
+			result, err := searcher.Search(ctx, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found {
+				t.Errorf("found = true, want false")
+			}
+			if ctx.Err() != nil {
+				t.Errorf("search ran until the timeout instead of stopping at EOF")
+			}
+		})
+	}
+}
+
+func TestSearchLastLineWithoutNewline(t *testing.T) {
+	searcher := newTestSearcher("starting up\nService started", newTestPod("app", corev1.PodRunning, "app"))
+	var shown bytes.Buffer
+	searcher.Stdout = &shown
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		NoFollow:       true,
+		ShowMatch:      true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found || result.Pods[0].MatchedLine != "Service started" {
+		t.Errorf("found = %v with line %q, want the unterminated last line", result.Found, result.Pods[0].MatchedLine)
+	}
+	if !strings.Contains(shown.String(), "app:L2: Service started\n") {
+		t.Errorf("shown match = %q, want it as line 2", shown.String())
+	}
+}
+
+func TestSearchMultiline(t *testing.T) {
+	logs := "Exception in thread main\n\tat com.example.Db.connect\nCaused by: java.net.SocketTimeoutException\nrecovered\n"
+	pattern := `Exception in thread(?s:.*)Caused by: \S*Timeout`
+
+	tests := []struct {
+		name      string
+		multiline bool
+		window    int
+		wantFound bool
+	}{
+		{name: "line by line", wantFound: false},
+		{name: "multiline", multiline: true, wantFound: true},
+		{name: "window too small", multiline: true, window: 50, wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher(logs, newTestPod("app", corev1.PodRunning, "app"))
+			result, err := searcher.Search(context.Background(), Options{
+				PodName:         "app",
+				Namespace:       "default",
+				SearchPatterns:  []string{pattern},
+				Regex:           true,
+				Multiline:       tt.multiline,
+				MultilineWindow: tt.window,
+				NoFollow:        true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+			if tt.wantFound && result.Pods[0].MatchedLine != "Caused by: java.net.SocketTimeoutException" {
+				t.Errorf("matched line = %q, want the line completing the match", result.Pods[0].MatchedLine)
+			}
+		})
+	}
+}
+
+func TestMultilineWindowConsumesMatches(t *testing.T) {
+	logs := "begin\nend\nend\nbegin\nend\n"
+	searcher := newTestSearcher(logs, newTestPod("app", corev1.PodRunning, "app"))
+
+	// Each "begin ... end" block counts once, however many lines follow it
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{`begin\nend`},
+		Regex:          true,
+		Multiline:      true,
+		Count:          3,
+		NoFollow:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Found {
+		t.Errorf("found = true, want false with only two blocks")
+	}
+}
+
+func TestSearchDaemonSet(t *testing.T) {
+	labels := map[string]string{"app": "agent"}
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+		Spec:       appsv1.DaemonSetSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+	}
+	objects := []runtime.Object{daemonSet}
+	for _, name := range []string{"agent-a", "agent-b", "other"} {
+		pod := newTestPod(name, corev1.PodRunning, "agent")
+		pod.Labels = labels
+		if name != "other" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent"}}
+		}
+		objects = append(objects, pod)
+	}
+	searcher := newTestSearcher("Agent ready\n", objects...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		DaemonSetName:  "agent",
+		Namespace:      "default",
+		SearchPatterns: []string{"Agent ready"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Errorf("found = false, want true")
+	}
+	if matched := result.MatchedPods(); len(matched) != 2 {
+		t.Errorf("matched pods = %v, want the two pods owned by the daemonset", matched)
+	}
+}
+
+func TestDiscoveryRetriesTransientErrors(t *testing.T) {
+	pod := newTestPod("web-a", corev1.PodRunning, "web")
+	pod.Labels = map[string]string{"app": "web"}
+
+	selector := Options{LabelSelector: "app=web", Namespace: "default"}
+	for _, tt := range []struct {
+		name       string
+		opts       Options
+		verb       string
+		err        error
+		maxRetries int
+		wantCalls  int
+		wantErr    bool
+	}{
+		{name: "retried", opts: selector, verb: "list", err: apierrors.NewServiceUnavailable("blip"), maxRetries: 3, wantCalls: 2},
+		{name: "retries exhausted", opts: selector, verb: "list", err: apierrors.NewTooManyRequests("slow down", 0), maxRetries: 0, wantCalls: 1, wantErr: true},
+		{name: "not retryable", opts: selector, verb: "list", err: apierrors.NewForbidden(corev1.Resource("pods"), "", fmt.Errorf("denied")), maxRetries: 3, wantCalls: 1, wantErr: true},
+		{name: "single pod retried", opts: Options{PodName: "web-a", Namespace: "default"}, verb: "get", err: apierrors.NewServiceUnavailable("blip"), maxRetries: 3, wantCalls: 2},
+		{name: "pod in all namespaces retried", opts: Options{PodName: "web-a", AllNamespaces: true}, verb: "list", err: apierrors.NewServiceUnavailable("blip"), maxRetries: 3, wantCalls: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher("", pod)
+			calls := 0
+			searcher.client.(*fake.Clientset).PrependReactor(tt.verb, "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+				calls++
+				if calls == 1 {
+					return true, nil, tt.err
+				}
+				return false, nil, nil
+			})
+
+			opts := tt.opts
+			opts.MaxRetries = tt.maxRetries
+			_, err := searcher.DiscoverPods(context.Background(), opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%s calls = %d, want %d", tt.verb, calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		opts           Options
+		namespaces     []string
+		denied         string
+		wantErr        string
+		wantSeen       []string
+		wantNamespaces []string
+	}{
+		{
+			name:     "single pod allowed",
+			opts:     Options{PodName: "web-a", Namespace: "default"},
+			wantSeen: []string{"get pods", "get pods/log"},
+		},
+		{
+			name:     "deployment allowed",
+			opts:     Options{DeploymentName: "web", Namespace: "default", WatchPods: true},
+			wantSeen: []string{"get deployments.apps", "list replicasets.apps", "get pods", "list pods", "watch pods", "get pods/log"},
+		},
+		{
+			name:     "cronjob allowed",
+			opts:     Options{CronJobName: "backup", Namespace: "default"},
+			wantSeen: []string{"get cronjobs.batch", "list jobs.batch", "get jobs.batch", "get pods", "list pods", "get pods/log"},
+		},
+		{
+			name:       "namespace selector checks every selected namespace",
+			opts:       Options{StatefulSetName: "db", Namespace: "default", NamespaceSelector: "team=data"},
+			namespaces: []string{"data-b", "data-a"},
+			wantSeen: []string{
+				"list namespaces",
+				"get statefulsets.apps", "get pods", "list pods", "get pods/log",
+				"get statefulsets.apps", "get pods", "list pods", "get pods/log",
+			},
+			wantNamespaces: []string{"", "data-a", "data-a", "data-a", "data-a", "data-b", "data-b", "data-b", "data-b"},
+		},
+		{
+			name:       "denied in a selected namespace",
+			opts:       Options{StatefulSetName: "db", Namespace: "default", NamespaceSelector: "team=data"},
+			namespaces: []string{"data-a"},
+			denied:     "statefulsets.apps",
+			wantErr:    "you lack 'get' on statefulsets.apps in namespace 'data-a'",
+		},
+		{
+			name:    "logs denied",
+			opts:    Options{LabelSelector: "app=web", Namespace: "prod"},
+			denied:  "pods/log",
+			wantErr: "you lack 'get' on pods/log in namespace 'prod'",
+		},
+		{
+			name:    "list denied in all namespaces",
+			opts:    Options{PodName: "web-a", AllNamespaces: true},
+			denied:  "pods",
+			wantErr: "you lack 'get' on pods in all namespaces",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, name := range tt.namespaces {
+				objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": "data"}}})
+			}
+			searcher := newTestSearcher("", objects...)
+			var seen, namespaces []string
+			searcher.client.(*fake.Clientset).PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+				attributes := review.Spec.ResourceAttributes
+				check := accessCheck{verb: attributes.Verb, group: attributes.Group, resource: attributes.Resource, subresource: attributes.Subresource}
+				seen = append(seen, attributes.Verb+" "+check.String())
+				namespaces = append(namespaces, attributes.Namespace)
+				review.Status.Allowed = check.String() != tt.denied
+				return true, review, nil
+			})
+
+			err := searcher.CheckAccess(context.Background(), tt.opts)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrAccessDenied) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(seen, tt.wantSeen) {
+				t.Errorf("checked %v, want %v", seen, tt.wantSeen)
+			}
+			if tt.wantNamespaces != nil && !reflect.DeepEqual(namespaces, tt.wantNamespaces) {
+				t.Errorf("checked in namespaces %q, want %q", namespaces, tt.wantNamespaces)
+			}
+		})
+	}
+}
+
+func TestDiscoveryFieldSelector(t *testing.T) {
+	pod := newTestPod("web-a", corev1.PodRunning, "web")
+	pod.Labels = map[string]string{"app": "web"}
+	searcher := newTestSearcher("", pod)
+	var listed metav1.ListOptions
+	searcher.client.(*fake.Clientset).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		restrictions := action.(k8stesting.ListAction).GetListRestrictions()
+		listed = metav1.ListOptions{LabelSelector: restrictions.Labels.String(), FieldSelector: restrictions.Fields.String()}
+		return false, nil, nil
+	})
+
+	_, err := searcher.DiscoverPods(context.Background(), Options{LabelSelector: "app=web", FieldSelector: "spec.nodeName=node-1", Namespace: "default"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if listed.LabelSelector != "app=web" || listed.FieldSelector != "spec.nodeName=node-1" {
+		t.Errorf("listed pods with %+v, want both selectors", listed)
+	}
+}
+
+func TestSearchZeroReplicas(t *testing.T) {
+	zero := int32(0)
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	objects := []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &zero, Selector: selector},
+		},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &zero, Selector: selector},
+		},
+	}
+
+	for _, opts := range []Options{{DeploymentName: "web"}, {StatefulSetName: "db"}} {
+		opts.Namespace = "default"
+		opts.SearchPatterns = []string{"Service started"}
+		_, err := newTestSearcher("", objects...).Search(context.Background(), opts)
+		resourceType, name := opts.Resource()
+		if !errors.Is(err, ErrZeroReplicas) || err.Error() != fmt.Sprintf("%s '%s' has 0 desired replicas", resourceType, name) {
+			t.Errorf("%s: err = %v, want ErrZeroReplicas", resourceType, err)
+		}
+	}
+}
+
+func TestSearchIncludeNotRunning(t *testing.T) {
+	failed := newTestPod("web-failed", corev1.PodFailed, "web")
+	unknown := newTestPod("web-unknown", corev1.PodUnknown, "web")
+	for _, pod := range []*corev1.Pod{failed, unknown} {
+		pod.Labels = map[string]string{"app": "web"}
+	}
+
+	for _, include := range []bool{false, true} {
+		result, err := newTestSearcher("panic: out of memory\n", failed, unknown).Search(context.Background(), Options{
+			LabelSelector:     "app=web",
+			Namespace:         "default",
+			SearchPatterns:    []string{"panic:"},
+			IncludeNotRunning: include,
+		})
+		if !include {
+			if !errors.Is(err, ErrNoActivePods) {
+				t.Errorf("skipped: err = %v, want ErrNoActivePods", err)
+			}
+			continue
+		}
+		if err != nil || !result.Found || len(result.Pods) != 2 {
+			t.Errorf("included: result = %+v, err = %v; want both pods searched", result, err)
+		}
+	}
+}
+
+func TestSearchIncludeTerminating(t *testing.T) {
+	pod := newTestPod("web-old", corev1.PodRunning, "web")
+	pod.Labels = map[string]string{"app": "web"}
+	now := metav1.Now()
+	pod.DeletionTimestamp = &now
+
+	for _, include := range []bool{false, true} {
+		searcher := newTestSearcher("graceful shutdown complete\n", pod)
+		var stderr bytes.Buffer
+		searcher.Stderr = &stderr
+		searcher.Verbosity = VerbosityDiscovery
+		result, err := searcher.Search(context.Background(), Options{
+			LabelSelector:      "app=web",
+			Namespace:          "default",
+			SearchPatterns:     []string{"graceful shutdown complete"},
+			IncludeTerminating: include,
+		})
+		if !include {
+			if !errors.Is(err, ErrNoActivePods) || !strings.Contains(stderr.String(), "see -include-terminating") {
+				t.Errorf("skipped: err = %v, stderr = %q; want the pod skipped naming the flag", err, stderr.String())
+			}
+			continue
+		}
+		if err != nil || !result.Found {
+			t.Errorf("included: found = %v, err = %v", result.Found, err)
+		}
+	}
+}
+
+func TestSearchLenientOwner(t *testing.T) {
+	replicas := int32(1)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+	}
+	pod := newTestPod("web-adopted", corev1.PodRunning, "web")
+	pod.Labels = map[string]string{"app": "web"}
+
+	for _, lenient := range []bool{false, true} {
+		result, err := newTestSearcher("Service started\n", deployment, pod).Search(context.Background(), Options{
+			DeploymentName: "web",
+			Namespace:      "default",
+			SearchPatterns: []string{"Service started"},
+			LenientOwner:   lenient,
+			NoFollow:       true,
+		})
+		if !lenient {
+			if err == nil || err.Error() != "no active ReplicaSet found for deployment 'web'" {
+				t.Errorf("strict: err = %v, want the missing ReplicaSet reported", err)
+			}
+			continue
+		}
+		if err != nil || !result.Found || result.Pods[0].PodName != "web-adopted" {
+			t.Errorf("lenient: result = %+v, err = %v; want the selector's pod searched", result, err)
+		}
+	}
+}
+
+func TestDeploymentActiveReplicaSet(t *testing.T) {
+	// ReplicaSet of a revision of deployment web, with one running pod
+	generation := func(hash, revision string, replicas int32) []runtime.Object {
+		rs := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-" + hash,
+				Namespace:       "default",
+				Labels:          map[string]string{"app": "web", "pod-template-hash": hash},
+				Annotations:     map[string]string{"deployment.kubernetes.io/revision": revision},
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}},
+			},
+			Spec: appsv1.ReplicaSetSpec{Replicas: &replicas},
+		}
+		pod := newTestPod("web-"+hash+"-1", corev1.PodRunning, "web")
+		pod.Labels = rs.Labels
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: rs.Name}}
+		return []runtime.Object{rs, pod}
+	}
+	replicas := int32(3)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+	}
+
+	tests := []struct {
+		name        string
+		generations [][]runtime.Object
+		want        string
+	}{
+		// The old ReplicaSet still has most replicas while the new one scales up
+		{name: "mid-rollout", generations: [][]runtime.Object{generation("old", "1", 3), generation("new", "2", 1)}, want: "web-new-1"},
+		// A rollback gives the restored ReplicaSet the latest revision
+		{name: "after rollback", generations: [][]runtime.Object{generation("old", "3", 3), generation("new", "2", 0)}, want: "web-old-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := []runtime.Object{deployment}
+			for _, generation := range tt.generations {
+				objects = append(objects, generation...)
+			}
+			pods, err := newTestSearcher("", objects...).DiscoverPods(context.Background(), Options{DeploymentName: "web", Namespace: "default"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pods) != 1 || pods[0].Name != tt.want {
+				t.Errorf("pods = %v, want only %s", pods, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeploymentConfigPods(t *testing.T) {
+	// ReplicationController of a version of DeploymentConfig web, with one running pod
+	version := func(number string, replicas int32) []runtime.Object {
+		rc := &corev1.ReplicationController{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web-" + number,
+				Namespace:   "default",
+				Labels:      map[string]string{"openshift.io/deployment-config.name": "web"},
+				Annotations: map[string]string{"openshift.io/deployment-config.latest-version": number},
+			},
+			Spec: corev1.ReplicationControllerSpec{Replicas: &replicas},
+		}
+		pod := newTestPod("web-"+number+"-abcde", corev1.PodRunning, "web")
+		pod.Labels = map[string]string{"deploymentconfig": "web", "deployment": rc.Name}
+		return []runtime.Object{rc, pod}
+	}
+
+	tests := []struct {
+		name     string
+		versions [][]runtime.Object
+		want     string
+	}{
+		{name: "rolled out", versions: [][]runtime.Object{version("1", 3), version("2", 1)}, want: "web-2-abcde"},
+		// A failed rollout scales its version down and the previous one back up
+		{name: "failed rollout", versions: [][]runtime.Object{version("1", 3), version("2", 0)}, want: "web-1-abcde"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []runtime.Object
+			for _, version := range tt.versions {
+				objects = append(objects, version...)
+			}
+			pods, err := newTestSearcher("", objects...).DiscoverPods(context.Background(), Options{DeploymentConfigName: "web", Namespace: "default"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(pods) != 1 || pods[0].Name != tt.want {
+				t.Errorf("pods = %v, want only %s", pods, tt.want)
+			}
+		})
+	}
+
+	// Clusters without OpenShift have no ReplicationController of it
+	_, err := newTestSearcher("").DiscoverPods(context.Background(), Options{DeploymentConfigName: "web", Namespace: "default"})
+	if !errors.Is(err, ErrResourceNotFound) {
+		t.Errorf("err = %v, want ErrResourceNotFound", err)
+	}
+}
+
+func TestSearchErrorSentinels(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    error
+		wantMsg string
+	}{
+		{name: "missing pod", opts: Options{PodName: "gone"}, want: ErrResourceNotFound, wantMsg: "pod 'gone' not found in namespace 'default'"},
+		{name: "no pods for selector", opts: Options{LabelSelector: "app=none"}, want: ErrNoActivePods, wantMsg: "no active pods found for selector 'app=none'"},
+		{name: "several containers", opts: Options{PodName: "app"}, want: ErrMultipleContainers, wantMsg: "pod 'app' has multiple containers (app, sidecar), please specify a container name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher("", newTestPod("app", corev1.PodRunning, "app", "sidecar"))
+			tt.opts.Namespace = "default"
+			tt.opts.SearchPatterns = []string{"Service started"}
+			_, err := searcher.Search(context.Background(), tt.opts)
+			if !errors.Is(err, tt.want) || err.Error() != tt.wantMsg {
+				t.Errorf("err = %v, want %q wrapping %v", err, tt.wantMsg, tt.want)
+			}
+		})
+	}
+
+	// The Kubernetes API error stays in the chain
+	_, err := newTestSearcher("").Search(context.Background(), Options{PodName: "gone", Namespace: "default", SearchPatterns: []string{"x"}})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("err = %v, want a Kubernetes NotFound error", err)
+	}
+}
+
+func TestSearchDefaultFirstContainer(t *testing.T) {
+	searcher := newTestSearcher("", newTestPod("app", corev1.PodRunning, "app", "sidecar"))
+	var stderr bytes.Buffer
+	searcher.Stderr = &stderr
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		if logOptions.Container != "app" {
+			t.Errorf("container = %q, want the first one", logOptions.Container)
+		}
+		return io.NopCloser(strings.NewReader("Service started\n")), nil
+	}
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:               "app",
+		Namespace:             "default",
+		SearchPatterns:        []string{"Service started"},
+		DefaultFirstContainer: true,
+		NoFollow:              true,
+	})
+	if err != nil || !result.Found {
+		t.Fatalf("found = %v, err = %v", result.Found, err)
+	}
+	if want := "Defaulted to container 'app' of pod 'app' out of: app, sidecar\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestSearchAllContainersReportsContainer(t *testing.T) {
+	searcher := newTestSearcher("", newTestPod("app", corev1.PodRunning, "app", "sidecar"))
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		if logOptions.Container == "sidecar" {
+			return io.NopCloser(strings.NewReader("Service started\n")), nil
+		}
+		return io.NopCloser(strings.NewReader("Starting\n")), nil
+	}
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		AllContainers:  true,
+		NoFollow:       true,
+	})
+	if err != nil || !result.Found {
+		t.Fatalf("found = %v, err = %v", result.Found, err)
+	}
+	if got := result.Pods[0].Container; got != "sidecar" {
+		t.Errorf("container = %q, want sidecar", got)
+	}
+}
+
+func TestSearchNamespaceSelector(t *testing.T) {
+	var objects []runtime.Object
+	for _, namespace := range []struct {
+		name, team string
+	}{{"payments-b", "payments"}, {"payments-a", "payments"}, {"billing", "billing"}, {"payments-empty", "payments"}} {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace.name, Labels: map[string]string{"team": namespace.team}}})
+		if namespace.name == "payments-empty" {
+			continue
+		}
+		pod := newTestPod("web-"+namespace.name, corev1.PodRunning, "web")
+		pod.Namespace = namespace.name
+		pod.Labels = map[string]string{"app": "web"}
+		objects = append(objects, pod)
+	}
+
+	searcher := newTestSearcher("Service started\n", objects...)
+	result, err := searcher.Search(context.Background(), Options{
+		LabelSelector:     "app=web",
+		NamespaceSelector: "team=payments",
+		SearchPatterns:    []string{"Service started"},
+		NoFollow:          true,
+		Concurrency:       1,
+	})
+	if err != nil || !result.Found {
+		t.Fatalf("found = %v, err = %v", result.Found, err)
+	}
+	var namespaces []string
+	for _, pod := range result.Pods {
+		namespaces = append(namespaces, pod.Namespace)
+	}
+	if want := []string{"payments-a", "payments-b"}; !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("namespaces = %v, want %v", namespaces, want)
+	}
+
+	_, err = searcher.Search(context.Background(), Options{
+		LabelSelector:     "app=web",
+		NamespaceSelector: "team=unknown",
+		SearchPatterns:    []string{"Service started"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "no namespaces match selector 'team=unknown'") {
+		t.Errorf("err = %v, want no matching namespaces reported", err)
+	}
+}
+
+func TestSearchStrictPods(t *testing.T) {
+	running := newTestPod("web-a", corev1.PodRunning, "web")
+	pending := newTestPod("web-b", corev1.PodPending, "web")
+	for _, pod := range []*corev1.Pod{running, pending} {
+		pod.Labels = map[string]string{"app": "web"}
+	}
+
+	for _, strict := range []bool{false, true} {
+		searcher := newTestSearcher("Service started\n", running, pending)
+		result, err := searcher.Search(context.Background(), Options{
+			LabelSelector:  "app=web",
+			Namespace:      "default",
+			SearchPatterns: []string{"Service started"},
+			StrictPods:     strict,
+		})
+		if !strict {
+			if err != nil || !result.Found {
+				t.Errorf("lenient: found = %v, err = %v; want the pending pod skipped", result.Found, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "pod 'web-b' of selector 'app=web' is not running (phase: Pending)") {
+			t.Errorf("strict: err = %v, want the pending pod reported", err)
+		}
+	}
+}
+
+func TestSearchSelectorInAllNamespaces(t *testing.T) {
+	var objects []runtime.Object
+	for _, namespace := range []string{"team-a", "team-b"} {
+		pod := newTestPod("web", corev1.PodRunning, "web")
+		pod.Namespace = namespace
+		pod.Labels = map[string]string{"app": "web"}
+		objects = append(objects, pod)
+	}
+	searcher := newTestSearcher("Service started\n", objects...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		AllNamespaces:  true,
+		SearchPatterns: []string{"Service started"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found || len(result.Pods) != 2 {
+		t.Fatalf("found = %v with %d pods, want both same-named pods to match", result.Found, len(result.Pods))
+	}
+	for _, pod := range result.Pods {
+		if !pod.Found {
+			t.Errorf("pod %s/%s did not match", pod.Namespace, pod.PodName)
+		}
+	}
+}
+
+func TestSearchShowMatchWithContext(t *testing.T) {
+	searcher := newTestSearcher("one\ntwo\nService started\nthree\nfour\n", newTestPod("app", corev1.PodRunning, "app"))
+	var stdout bytes.Buffer
+	searcher.Stdout = &stdout
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		ShowMatch:      true,
+		BeforeLines:    1,
+		AfterLines:     1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Errorf("found = false, want true")
+	}
+
+	want := "app-L2- two\napp:L3: Service started\napp-L4- three\n"
+	if stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestSearchReconnectsDroppedStream(t *testing.T) {
+	pod := newTestPod("app", corev1.PodRunning, "app")
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+		Name:  "app",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}}
+	searcher := newTestSearcher("", pod)
+
+	// The first stream drops before the pattern is logged, the second one delivers it
+	var opened []*corev1.PodLogOptions
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		opened = append(opened, logOptions)
+		if len(opened) == 1 {
+			return io.NopCloser(strings.NewReader("starting up\n")), nil
+		}
+		return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader("Service started\n")}), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		MaxReconnects:  1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Errorf("found = false, want true")
+	}
+	if len(opened) != 2 || opened[1].SinceTime == nil {
+		t.Errorf("expected one reconnect resuming at the drop, got %d streams", len(opened))
+	}
+}
+
+func TestSearchReopensIdleStream(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		state      corev1.ContainerState
+		wantFound  bool
+		wantOpened int
+	}{
+		{name: "running container", state: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}, wantFound: true, wantOpened: 3},
+		{name: "stopped container", state: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}, wantOpened: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := newTestPod("app", corev1.PodRunning, "app")
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "app", State: tt.state}}
+			searcher := newTestSearcher("", pod)
+			var stdout bytes.Buffer
+			searcher.Stdout = &stdout
+
+			// The first two streams stay open without any output, the third one delivers the pattern
+			var opened []*corev1.PodLogOptions
+			searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+				opened = append(opened, logOptions)
+				logs := ""
+				if len(opened) == 3 {
+					logs = "Service started\n"
+				}
+				return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader(logs)}), nil
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := searcher.Search(ctx, Options{
+				PodName:        "app",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				ReadTimeout:    50 * time.Millisecond,
+				// Idle reopens don't use up the reconnect budget
+				MaxReconnects: 1,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+			if len(opened) != tt.wantOpened {
+				t.Fatalf("opened %d streams, want %d", len(opened), tt.wantOpened)
+			}
+			for i, logOptions := range opened[1:] {
+				if logOptions.SinceTime == nil {
+					t.Errorf("reopened stream %d doesn't resume from when output stopped", i+2)
+				}
+			}
+			if strings.Contains(stdout.String(), "reopening log stream") {
+				t.Errorf("idle reopens logged at the default verbosity: %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestSearchTimestamps(t *testing.T) {
+	logs := "2024-05-01T10:00:00.123456789Z starting up\n2024-05-01T10:00:01.123456789Z Service started\n"
+
+	tests := []struct {
+		name            string
+		pattern         string
+		matchTimestamps bool
+		wantFound       bool
+	}{
+		{name: "anchored pattern without the timestamp", pattern: "^Service started", wantFound: true},
+		{name: "timestamp not matched by default", pattern: "^2024-05-01T10:00:01"},
+		{name: "timestamp matched with match timestamps", pattern: "^2024-05-01T10:00:01", matchTimestamps: true, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher("", newTestPod("app", corev1.PodRunning, "app"))
+			searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+				if !logOptions.Timestamps {
+					t.Errorf("log stream opened without timestamps")
+				}
+				return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader(logs)}), nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			result, err := searcher.Search(ctx, Options{
+				PodName:         "app",
+				Namespace:       "default",
+				SearchPatterns:  []string{tt.pattern},
+				Regex:           true,
+				Timestamps:      true,
+				MatchTimestamps: tt.matchTimestamps,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestSearchFromStart(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	pod := newTestPod("app", corev1.PodRunning, "app")
+	pod.CreationTimestamp = metav1.NewTime(created)
+	searcher := newTestSearcher("", pod)
+	var stderr bytes.Buffer
+	searcher.Stderr = &stderr
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		if logOptions.SinceTime == nil || !logOptions.SinceTime.Time.Equal(created) {
+			t.Errorf("since time = %v, want the pod's creation", logOptions.SinceTime)
+		}
+		return io.NopCloser(strings.NewReader("2024-05-01T10:00:02Z Service started\n")), nil
+	}
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		FromStart:      true,
+		Timestamps:     true,
+		NoFollow:       true,
+	})
+	if err != nil || !result.Found {
+		t.Fatalf("found = %v, err = %v", result.Found, err)
+	}
+	want := "Reading logs of pod 'app' from its creation at 2024-05-01T10:00:00Z\n" +
+		"Earliest log line available from pod 'app' is from 2024-05-01T10:00:02Z\n"
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestSearchCRLF(t *testing.T) {
+	logs := "2024-05-01T10:00:00Z starting\r\n" +
+		"2024-05-01T10:00:01Z {\"level\":\"info\",\"msg\":\"ready\"}\r\n" +
+		"2024-05-01T10:00:02Z Service started\r\n"
+
+	tests := []struct {
+		name     string
+		opts     Options
+		wantLine string
+	}{
+		{name: "anchored regex", opts: Options{SearchPatterns: []string{"^Service started$"}, Regex: true}, wantLine: "2024-05-01T10:00:02Z Service started"},
+		{name: "whole line", opts: Options{SearchPatterns: []string{"Service started"}, WholeLine: true}, wantLine: "2024-05-01T10:00:02Z Service started"},
+		{name: "JSON fields", opts: Options{SearchPatterns: []string{"msg=ready"}, JSONFields: true}, wantLine: `2024-05-01T10:00:01Z {"level":"info","msg":"ready"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher(logs, newTestPod("app", corev1.PodRunning, "app"))
+			var stdout bytes.Buffer
+			searcher.Stdout = &stdout
+			searcher.Verbosity = VerbosityLogs
+			opts := tt.opts
+			opts.PodName = "app"
+			opts.Namespace = "default"
+			opts.Timestamps = true
+			opts.NoFollow = true
+			if err := opts.Compile(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			result, err := searcher.Search(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.Found || result.Pods[0].MatchedLine != tt.wantLine {
+				t.Errorf("found = %v, matched line = %q, want %q", result.Found, result.Pods[0].MatchedLine, tt.wantLine)
+			}
+			// Debug output keeps the original bytes
+			if !strings.Contains(stdout.String(), "[app] 2024-05-01T10:00:00Z starting\r\n") {
+				t.Errorf("debug output lost the carriage return: %q", stdout.String())
+			}
+		})
+	}
+}
+
+func TestSearchWithin(t *testing.T) {
+	recent := time.Now().Add(-5 * time.Second).UTC().Format(time.RFC3339Nano)
+	tests := []struct {
+		name      string
+		logs      string
+		wantFound bool
+		wantLine  int
+	}{
+		{name: "old match doesn't count", logs: "2024-05-01T10:00:01Z Service started\n"},
+		{name: "line without timestamp doesn't count", logs: "Service started\n"},
+		{name: "recent match counts", logs: "2024-05-01T10:00:01Z Service started\n" + recent + " Service started\n", wantFound: true, wantLine: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestSearcher(tt.logs, newTestPod("app", corev1.PodRunning, "app"))
+			result, err := searcher.Search(context.Background(), Options{
+				PodName:        "app",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				Timestamps:     true,
+				Within:         30 * time.Second,
+				NoFollow:       true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+			if tt.wantFound && result.Pods[0].LineNumber != tt.wantLine {
+				t.Errorf("line = %d, want %d", result.Pods[0].LineNumber, tt.wantLine)
+			}
+		})
+	}
+}
+
+// countingReader tracks how many log streams are open at once
+type countingReader struct {
+	io.Reader
+	open *int32
+}
+
+func (r *countingReader) Close() error {
+	atomic.AddInt32(r.open, -1)
+	return nil
+}
+
+func TestSearchResourceConcurrency(t *testing.T) {
+	labels := map[string]string{"app": "web"}
+	var objects []runtime.Object
+	for _, name := range []string{"web-a", "web-b", "web-c", "web-d"} {
+		pod := newTestPod(name, corev1.PodRunning, "web")
+		pod.Labels = labels
+		objects = append(objects, pod)
+	}
+	searcher := newTestSearcher("", objects...)
+
+	var open, maxOpen int32
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, _ *corev1.PodLogOptions) (io.ReadCloser, error) {
+		current := atomic.AddInt32(&open, 1)
+		for {
+			seen := atomic.LoadInt32(&maxOpen)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxOpen, seen, current) {
+				break
+			}
+		}
+		// Hold the stream open briefly so overlapping searches would be noticed
+		time.Sleep(20 * time.Millisecond)
+		return &countingReader{Reader: strings.NewReader("Service started\n"), open: &open}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		Concurrency:    2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Errorf("found = false, want true")
+	}
+	if maxOpen > 2 {
+		t.Errorf("%d log streams were open at once, want at most 2", maxOpen)
+	}
+}
+
+// Create a searcher for pods labeled app=web, each streaming its own logs; pods mapped to
+// "!error" fail to open their stream
+func newTestResourceSearcher(podLogs map[string]string) *Searcher {
+	var objects []runtime.Object
+	for name := range podLogs {
+		pod := newTestPod(name, corev1.PodRunning, "web")
+		pod.Labels = map[string]string{"app": "web"}
+		objects = append(objects, pod)
+	}
+	searcher := newTestSearcher("", objects...)
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, podName string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		logs := podLogs[podName]
+		if logs == "!error" {
+			return nil, fmt.Errorf("stream refused")
+		}
+		if !logOptions.Follow {
+			return io.NopCloser(strings.NewReader(logs)), nil
+		}
+		return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader(logs)}), nil
+	}
+	return searcher
+}
+
+func TestSearchPodPattern(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{
+		"web-7d9c-a": "Service started\n",
+		"web-7d9c-b": "Service started\n",
+		"api-5f6b-a": "starting up\n",
+	})
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "web-*",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		NoFollow:       true,
+	})
+	if err != nil || !result.Found || len(result.Pods) != 2 {
+		t.Fatalf("result = %+v, err = %v; want both web pods searched", result, err)
+	}
+	for _, pod := range result.Pods {
+		if !strings.HasPrefix(pod.PodName, "web-") {
+			t.Errorf("searched pod %s, which doesn't match the pattern", pod.PodName)
+		}
+	}
+
+	_, err = searcher.Search(context.Background(), Options{
+		PodName:        "db-?",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+	})
+	if !errors.Is(err, ErrResourceNotFound) || err.Error() != "pods matching 'db-?' not found in namespace 'default'" {
+		t.Errorf("err = %v, want no matching pods reported", err)
+	}
+}
+
+func TestSearchTargets(t *testing.T) {
+	targets := []Target{{Type: ResourceTypePod, Name: "web-a"}, {Type: ResourceTypeSelector, Name: "app=web"}}
+	tests := []struct {
+		name      string
+		podLogs   map[string]string
+		require   Requirement
+		wantFound bool
+	}{
+		{
+			name:      "every pod of every target matches",
+			podLogs:   map[string]string{"web-a": "Service started\n", "web-b": "Service started\n", "db-0": "Service started\n"},
+			wantFound: true,
+		},
+		{
+			name:    "a pod of one target doesn't match",
+			podLogs: map[string]string{"web-a": "Service started\n", "web-b": "Service started\n", "db-0": "starting up\n"},
+		},
+		{
+			name:      "any pod of any target matches",
+			podLogs:   map[string]string{"web-a": "starting up\n", "web-b": "starting up\n", "db-0": "Service started\n"},
+			require:   RequireAny,
+			wantFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestResourceSearcher(tt.podLogs)
+			result, err := searcher.Search(context.Background(), Options{
+				Targets:        targets,
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				Require:        tt.require,
+				NoFollow:       true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+
+			// web-a is selected by both targets but searched once, for the first of them
+			got := map[string]Target{}
+			for _, pod := range result.Pods {
+				if _, ok := got[pod.PodName]; ok {
+					t.Errorf("pod %s searched twice", pod.PodName)
+				}
+				got[pod.PodName] = pod.Target
+			}
+			want := map[string]Target{"web-a": targets[0], "web-b": targets[1], "db-0": targets[1]}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("pod targets = %v, want %v", got, want)
+			}
+		})
+	}
+
+	searcher := newTestResourceSearcher(map[string]string{"web-a": ""})
+	if _, err := searcher.Search(context.Background(), Options{Targets: targets, Namespace: "default", SearchPatterns: []string{"x"}, WatchPods: true}); err == nil {
+		t.Errorf("expected an error watching pods of several targets")
+	}
+}
+
+func TestSearchStreamMatches(t *testing.T) {
+	for _, noFollow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noFollow=%v", noFollow), func(t *testing.T) {
+			searcher := newTestResourceSearcher(map[string]string{
+				"web-a": "a: Service started\nidle\nb: Service started\n",
+				"web-b": "starting up\n",
+			})
+			var out bytes.Buffer
+			searcher.Stdout = &out
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			result, err := searcher.Search(ctx, Options{
+				LabelSelector:  "app=web",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				StreamMatches:  true,
+				NoFollow:       noFollow,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.Found {
+				t.Errorf("expected the search to be found")
+			}
+			if noFollow && ctx.Err() != nil {
+				t.Errorf("search ran until the timeout although every log ended")
+			}
+
+			// Every pod keeps being searched after its first match, and reports its matches at the timeout
+			matches := map[string]int{}
+			for _, pod := range result.Pods {
+				matches[pod.PodName] = pod.Matches
+			}
+			if !reflect.DeepEqual(matches, map[string]int{"web-a": 2, "web-b": 0}) {
+				t.Errorf("matches = %v, want 2 for web-a and none for web-b", matches)
+			}
+			if want := "[web-a] a: Service started\n[web-a] b: Service started\n"; out.String() != want {
+				t.Errorf("output = %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+// Searches of many pods that are canceled early must neither panic nor leak a send on the
+// closed result channel; run with -race to also catch unsynchronized access
+func TestSearchResourceCancellationStress(t *testing.T) {
+	podLogs := map[string]string{}
+	for i := 0; i < 100; i++ {
+		logs := "starting up\n"
+		if i%10 == 0 {
+			logs += "Service started\n"
+		}
+		podLogs[fmt.Sprintf("web-%03d", i)] = logs
+	}
+
+	for i := 0; i < 20; i++ {
+		searcher := newTestResourceSearcher(podLogs)
+		// Cancel at varying points: before, during and after the pods report
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i)*time.Millisecond)
+		opts := Options{
+			LabelSelector:  "app=web",
+			Namespace:      "default",
+			SearchPatterns: []string{"Service started"},
+			Concurrency:    i % 4 * 10,
+		}
+		if i%2 == 0 {
+			opts.Require = RequireAny
+		}
+		if _, err := searcher.Search(ctx, opts); err != nil && ctx.Err() == nil {
+			t.Errorf("iteration %d: unexpected error: %v", i, err)
+		}
+		cancel()
+	}
+}
+
+func TestSearchKeepGoing(t *testing.T) {
+	podLogs := map[string]string{"web-a": "!error", "web-b": "!error", "web-c": "starting up\n"}
+	for _, keepGoing := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keepGoing=%v", keepGoing), func(t *testing.T) {
+			searcher := newTestResourceSearcher(podLogs)
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			result, err := searcher.Search(ctx, Options{
+				LabelSelector:  "app=web",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				KeepGoing:      keepGoing,
+			})
+			if err == nil || result.Found {
+				t.Fatalf("expected the search to fail, got found=%v err=%v", result.Found, err)
+			}
+			if !keepGoing {
+				// The first failure decides the search without waiting for web-c
+				if ctx.Err() != nil {
+					t.Errorf("search ran until the timeout although a pod failed")
+				}
+				return
+			}
+			var podsErr *PodsFailedError
+			if !errors.As(err, &podsErr) || podsErr.PodCount != 3 || len(podsErr.Pods) != 2 {
+				t.Fatalf("error = %v, want a PodsFailedError for 2 out of 3 pods", err)
+			}
+			if want := "failed to search logs in 2 out of 3 pods:\n  web-a: "; !strings.HasPrefix(err.Error(), want) ||
+				!strings.Contains(err.Error(), "\n  web-b: ") {
+				t.Errorf("error = %q, want each failed pod listed", err)
+			}
+		})
+	}
+}
+
+// closeNotifier is a log stream closing a channel when it is closed
+type closeNotifier struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c closeNotifier) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestSearchOrderedOutput(t *testing.T) {
+	podLogs := map[string]string{}
+	for _, name := range []string{"web-a", "web-b", "web-c"} {
+		podLogs[name] = strings.Repeat("starting up\n", 20) + "Service started\n"
+	}
+	searcher := newTestResourceSearcher(podLogs)
+	var stdout bytes.Buffer
+	searcher.Stdout = &stdout
+	searcher.Verbosity = VerbosityLogs
+	// web-a only logs once the stream of web-b was closed, so live output would show web-b first
+	webBDone := make(chan struct{})
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, podName string, _ *corev1.PodLogOptions) (io.ReadCloser, error) {
+		switch podName {
+		case "web-a":
+			<-webBDone
+		case "web-b":
+			return closeNotifier{Reader: strings.NewReader(podLogs[podName]), closed: webBDone}, nil
+		}
+		return io.NopCloser(strings.NewReader(podLogs[podName])), nil
+	}
+
+	result, err := searcher.Search(context.Background(), Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		NoFollow:       true,
+		OrderedOutput:  true,
+	})
+	if err != nil || !result.Found {
+		t.Fatalf("found = %v, err = %v", result.Found, err)
+	}
+
+	// Each pod's lines form one block, in the order the pods were discovered
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		for _, pod := range result.Pods {
+			if strings.Contains(line, pod.PodName) && (len(order) == 0 || order[len(order)-1] != pod.PodName) {
+				order = append(order, pod.PodName)
+			}
+		}
+	}
+	var want []string
+	for _, pod := range result.Pods {
+		want = append(want, pod.PodName)
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("output blocks = %v, want %v:\n%s", order, want, stdout.String())
+	}
+}
+
+func TestSearchProgress(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{
+		"web-a": "Service started\n",
+		"web-b": "!error",
+		"web-c": "starting up\n",
+	})
+	statuses := map[string][]PodStatus{}
+	searcher.Progress = func(namespace, podName string, status PodStatus) {
+		statuses[podName] = append(statuses[podName], status)
+	}
+
+	if _, err := searcher.Search(context.Background(), Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		NoFollow:       true,
+		KeepGoing:      true,
+	}); err == nil {
+		t.Fatalf("expected the failed pod to fail the search")
+	}
+	want := map[string][]PodStatus{
+		"web-a": {PodSearching, PodMatched, PodMatched},
+		"web-b": {PodSearching, PodErrored, PodErrored},
+		"web-c": {PodSearching, PodNoMatch, PodNoMatch},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+}
+
+func TestSearchFirstMatch(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{
+		"web-a": "starting up\nloading config\nService started\n",
+		"web-b": "starting up\n",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		Require:        RequireAny,
+		NoFollow:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, ok := result.FirstMatch()
+	if !ok {
+		t.Fatalf("expected a first match")
+	}
+	if first.PodName != "web-a" || first.LineNumber != 3 || first.MatchedLine != "Service started" {
+		t.Errorf("first match = %s line %d %q, want web-a line 3", first.PodName, first.LineNumber, first.MatchedLine)
+	}
+}
+
+func TestSearchWaitingContainer(t *testing.T) {
+	waitingPod := func() *corev1.Pod {
+		pod := newTestPod("web-a", corev1.PodPending, "app")
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "app",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+		}}
+		return pod
+	}
+	opts := Options{PodName: "web-a", Namespace: "default", SearchPatterns: []string{"Service started"}}
+
+	searcher := newTestSearcher("Service started\n", waitingPod())
+	_, err := searcher.Search(context.Background(), opts)
+	if err == nil || !strings.Contains(err.Error(), "container 'app' in pod 'web-a' is Waiting: ImagePullBackOff (Back-off pulling image)") {
+		t.Errorf("err = %v, want the container's waiting reason", err)
+	}
+
+	// With WaitForReady the search starts once the container is running and ready
+	searcher = newTestSearcher("Service started\n", waitingPod())
+	gets := 0
+	searcher.client.(*fake.Clientset).PrependReactor("get", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		if gets == 1 {
+			return true, waitingPod(), nil
+		}
+		pod := newTestPod("web-a", corev1.PodRunning, "app")
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "app",
+			Ready: true,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		}}
+		return true, pod, nil
+	})
+	opts.WaitForReady = true
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := searcher.Search(ctx, opts)
+	if err != nil || !result.Found {
+		t.Errorf("found = %v, err = %v, want found once the container is ready", result.Found, err)
+	}
+}
+
+func TestSearchResourceRequire(t *testing.T) {
+	tests := []struct {
+		name     string
+		podLogs  map[string]string
+		require  Requirement
+		noFollow bool
+		// wantPrompt expects the outcome before the timeout
+		wantPrompt bool
+		wantFound  bool
+		wantErr    bool
+	}{
+		{
+			name:       "all pods match",
+			podLogs:    map[string]string{"web-a": "Service started\n", "web-b": "Service started\n"},
+			wantPrompt: true,
+			wantFound:  true,
+		},
+		{
+			name:    "one pod never matches",
+			podLogs: map[string]string{"web-a": "Service started\n", "web-b": "starting up\n"},
+		},
+		{
+			name:       "one pod ends without a match",
+			podLogs:    map[string]string{"web-a": "Service started\n", "web-b": "starting up\n"},
+			noFollow:   true,
+			wantPrompt: true,
+		},
+		{
+			name:       "one pod fails while another is still searching",
+			podLogs:    map[string]string{"web-a": "starting up\n", "web-b": "!error"},
+			wantPrompt: true,
+			wantErr:    true,
+		},
+		{
+			name:       "one pod fails after the others matched",
+			podLogs:    map[string]string{"web-a": "Service started\n", "web-b": "!error"},
+			wantPrompt: true,
+			wantErr:    true,
+		},
+		{
+			name:       "any pod matches",
+			podLogs:    map[string]string{"web-a": "Service started\n", "web-b": "starting up\n"},
+			require:    RequireAny,
+			wantPrompt: true,
+			wantFound:  true,
+		},
+		{
+			name:       "any pod matches despite a failed pod",
+			podLogs:    map[string]string{"web-a": "Service started\n", "web-b": "!error"},
+			require:    RequireAny,
+			wantPrompt: true,
+			wantFound:  true,
+		},
+		{
+			name:       "no pod matches",
+			podLogs:    map[string]string{"web-a": "starting up\n", "web-b": "starting up\n"},
+			require:    RequireAny,
+			noFollow:   true,
+			wantPrompt: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := newTestResourceSearcher(tt.podLogs)
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			result, err := searcher.Search(ctx, Options{
+				LabelSelector:  "app=web",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+				Require:        tt.require,
+				NoFollow:       tt.noFollow,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if result.Found != tt.wantFound {
+				t.Errorf("found = %v, want %v", result.Found, tt.wantFound)
+			}
+			if tt.wantPrompt && ctx.Err() != nil {
+				t.Errorf("search ran until the timeout instead of deciding as soon as possible")
+			}
+			if len(result.Pods) != len(tt.podLogs) {
+				t.Errorf("got %d pod results, want %d", len(result.Pods), len(tt.podLogs))
+			}
+		})
+	}
+}
+
+func TestSearchRequireAnyStopsOtherPods(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{"web-a": "Service started\n", "web-b": "starting up\n", "web-c": "starting up\n"})
+
+	// Match only once the other pods are streaming, then record when their streams are stopped
+	var opened sync.WaitGroup
+	opened.Add(2)
+	stopped := make(chan string, 2)
+	streamLogs := searcher.streamLogs
+	searcher.streamLogs = func(ctx context.Context, client Client, namespace, podName string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		if podName == "web-a" {
+			opened.Wait()
+		} else {
+			go func() {
+				<-ctx.Done()
+				stopped <- podName
+			}()
+			opened.Done()
+		}
+		return streamLogs(ctx, client, namespace, podName, logOptions)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		Require:        RequireAny,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matched := result.MatchedPods(); len(matched) != 1 || matched[0] != "web-a" {
+		t.Errorf("matched pods = %v, want [web-a]", matched)
+	}
+
+	for range 2 {
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatalf("the other pods kept searching after the first match")
+		}
+	}
+	if ctx.Err() != nil {
+		t.Errorf("search ran until the timeout instead of stopping at the first match")
+	}
+}
+
+func TestSearchWatchPods(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{"web-a": "starting up\n"})
+	// Pods are told apart by UID
+	client := searcher.client.(*fake.Clientset)
+	initial, err := client.CoreV1().Pods("default").Get(context.Background(), "web-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	initial.UID = "uid-a"
+	if _, err := client.CoreV1().Pods("default").Update(context.Background(), initial, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	streamLogs := searcher.streamLogs
+	searcher.streamLogs = func(ctx context.Context, client Client, namespace, podName string, logOptions *corev1.PodLogOptions) (io.ReadCloser, error) {
+		if podName == "web-b" {
+			return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader("Service started\n")}), nil
+		}
+		return streamLogs(ctx, client, namespace, podName, logOptions)
+	}
+
+	// Start the second pod once the search watches for new pods
+	go func() {
+		for {
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "watch" {
+					pod := newTestPod("web-b", corev1.PodRunning, "web")
+					pod.UID = "uid-b"
+					pod.Labels = map[string]string{"app": "web"}
+					_, _ = client.CoreV1().Pods("default").Create(context.Background(), pod, metav1.CreateOptions{})
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		Require:        RequireAny,
+		WatchPods:      true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matched := result.MatchedPods(); len(matched) != 1 || matched[0] != "web-b" {
+		t.Errorf("matched pods = %v, want the pod started during the search", matched)
+	}
+	if len(result.Pods) != 2 {
+		t.Errorf("got %d pod results, want 2", len(result.Pods))
+	}
+}
+
+func TestSearchWatchPodsWaitsForRollout(t *testing.T) {
+	replicas := int32(2)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+		// Mid-rollout: one replica runs the new template, the other one still the old template
+		Status: appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 1},
+	}
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "web-new",
+			Namespace:       "default",
+			Labels:          map[string]string{"app": "web", "pod-template-hash": "new"},
+			Annotations:     map[string]string{"deployment.kubernetes.io/revision": "2"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}},
+		},
+		Spec: appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	newPod := func(name string) *corev1.Pod {
+		pod := newTestPod(name, corev1.PodRunning, "web")
+		pod.UID = types.UID("uid-" + name)
+		pod.Labels = rs.Labels
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: rs.Name}}
+		return pod
+	}
+	searcher := newTestSearcher("", deployment, rs, newPod("web-new-1"))
+	client := searcher.client.(*fake.Clientset)
+	searcher.streamLogs = func(ctx context.Context, _ Client, _, _ string, _ *corev1.PodLogOptions) (io.ReadCloser, error) {
+		return io.NopCloser(&followReader{ctx: ctx, logs: strings.NewReader("Service started\n")}), nil
+	}
+
+	// Once the first pod matched, the rollout starts the second pod and completes
+	firstMatched := make(chan struct{})
+	var once sync.Once
+	searcher.Progress = func(_, podName string, status PodStatus) {
+		if podName == "web-new-1" && status == PodMatched {
+			once.Do(func() { close(firstMatched) })
+		}
+	}
+	go func() {
+		<-firstMatched
+		_, _ = client.CoreV1().Pods("default").Create(context.Background(), newPod("web-new-2"), metav1.CreateOptions{})
+		deployment.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2}
+		_, _ = client.AppsV1().Deployments("default").Update(context.Background(), deployment, metav1.UpdateOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		DeploymentName: "web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		WatchPods:      true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found || len(result.MatchedPods()) != 2 {
+		t.Errorf("found = %v with matched pods %v, want both pods of the rollout searched", result.Found, result.MatchedPods())
+	}
+	if ctx.Err() != nil {
+		t.Errorf("search ran until the timeout instead of ending once the rollout completed")
+	}
+}
+
+func TestSearchVerbosity(t *testing.T) {
+	tests := []struct {
+		verbosity Verbosity
+		want      []string
+		wantNot   []string
+	}{
+		{verbosity: VerbosityQuiet, wantNot: []string{"Found", "[web-a]"}},
+		{verbosity: VerbosityDiscovery, want: []string{"Found 1 pods"}, wantNot: []string{"Found pattern"}},
+		{verbosity: VerbosityMatches, want: []string{"Found 1 pods", "Found pattern"}, wantNot: []string{"[web-a]"}},
+		{verbosity: VerbosityLogs, want: []string{"Found pattern", "[web-a] Service started"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("level %d", tt.verbosity), func(t *testing.T) {
+			searcher := newTestResourceSearcher(map[string]string{"web-a": "Service started\n"})
+			var output bytes.Buffer
+			searcher.Stdout = &output
+			searcher.Stderr = &output
+			searcher.Verbosity = tt.verbosity
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, err := searcher.Search(ctx, Options{
+				LabelSelector:  "app=web",
+				Namespace:      "default",
+				SearchPatterns: []string{"Service started"},
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(output.String(), want) {
+					t.Errorf("output %q does not contain %q", output.String(), want)
+				}
+			}
+			for _, wantNot := range tt.wantNot {
+				if strings.Contains(output.String(), wantNot) {
+					t.Errorf("output %q contains %q", output.String(), wantNot)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchPodTimeout(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{"web-a": "Service started\n", "web-b": "starting up\n"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		PodTimeout:     100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Found {
+		t.Errorf("found = true, want false since web-b timed out")
+	}
+	if ctx.Err() != nil {
+		t.Errorf("search ran until the overall timeout instead of the pod timeout")
+	}
+}
+
+func TestSearchSummary(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{"web-a": "Service started\n", "web-b": "!error", "web-c": "starting up\n"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	result, err := searcher.Search(ctx, Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		ScanFull:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Summary{Pods: 3, Matched: 1, Errored: 1, TimedOut: 1}
+	if got := result.Summary(); got != want {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+	for _, pod := range result.Pods {
+		if pod.TimedOut != (pod.PodName == "web-c") {
+			t.Errorf("pod %s timedOut = %v", pod.PodName, pod.TimedOut)
+		}
+	}
+}
+
+func TestSearchMetrics(t *testing.T) {
+	searcher := newTestResourceSearcher(map[string]string{"web-a": "Service started\n", "web-b": "starting up\n"})
+	searcher.Metrics = NewMetrics()
+
+	_, err := searcher.Search(context.Background(), Options{
+		LabelSelector:  "app=web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		PodTimeout:     100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := searcher.Metrics.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		`klogs_needle_searches_total{result="not_found"} 1`,
+		`klogs_needle_searches_total{result="found"} 0`,
+		"klogs_needle_matches_total 1",
+		"klogs_needle_pods_searched_total 2",
+		"klogs_needle_pod_timeouts_total 1",
+		`klogs_needle_search_duration_seconds_bucket{le="1"} 1`,
+		"klogs_needle_search_duration_seconds_count 1",
+	} {
+		if !strings.Contains(buf.String(), want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSearchMatchOutput(t *testing.T) {
+	logs := "Service started on port 8080\nconnecting to database\nService started on port 9090\n"
+	searcher := newTestSearcher(logs, newTestPod("web", corev1.PodRunning, "app"))
+	var matches bytes.Buffer
+	searcher.MatchOutput = &matches
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "web",
+		Namespace:      "default",
+		SearchPatterns: []string{"Service started"},
+		Count:          2,
+		NoFollow:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Fatalf("found = false, want true")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(matches.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d matched lines, want 2:\n%s", len(lines), matches.String())
+	}
+	for i, want := range []string{"default/web/app: Service started on port 8080", "default/web/app: Service started on port 9090"} {
+		// Each line starts with the RFC3339 time it was read
+		if _, prefixed, ok := strings.Cut(lines[i], " "); !ok || prefixed != want {
+			t.Errorf("line %d = %q, want a time followed by %q", i, lines[i], want)
+		}
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	tests := []struct {
+		name          string
+		matcher       Matcher
+		line          string
+		wantMatch     bool
+		wantHighlight string
+	}{
+		{name: "literal match", matcher: literalMatcher("started"), line: "Service started, started", wantMatch: true, wantHighlight: "Service [started], [started]"},
+		{name: "literal no match", matcher: literalMatcher("stopped"), line: "Service started", wantHighlight: "Service started"},
+		{name: "literal is case sensitive", matcher: literalMatcher("service"), line: "Service started", wantHighlight: "Service started"},
+		{name: "regex match", matcher: regexMatcher{regexp.MustCompile(`port \d+`)}, line: "listening on port 8080", wantMatch: true, wantHighlight: "listening on [port 8080]"},
+		{name: "regex no match", matcher: regexMatcher{regexp.MustCompile(`^port`)}, line: "listening on port 8080", wantHighlight: "listening on port 8080"},
+		{name: "JSON fields match", matcher: jsonFieldMatcher{{path: []string{"level"}, value: "error"}}, line: `{"level":"error"}`, wantMatch: true, wantHighlight: `{"level":"error"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.matcher.Match(tt.line); got != tt.wantMatch {
+				t.Errorf("Match = %v, want %v", got, tt.wantMatch)
+			}
+			if got := tt.matcher.Highlight(tt.line, "[", "]"); got != tt.wantHighlight {
+				t.Errorf("Highlight = %q, want %q", got, tt.wantHighlight)
+			}
+		})
+	}
+}
+
+func TestCompileMatchers(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		want    Matcher
+		wantErr string
+	}{
+		{name: "literal", opts: Options{SearchPatterns: []string{"a.b"}}, want: literalMatcher("a.b")},
+		{name: "regex", opts: Options{SearchPatterns: []string{"a.b"}, Regex: true}, want: regexMatcher{regexp.MustCompile("a.b")}},
+		{name: "JSON fields", opts: Options{SearchPatterns: []string{"a.b=c"}, JSONFields: true}, want: jsonFieldMatcher{{path: []string{"a", "b"}, value: "c"}}},
+		{name: "invalid regex", opts: Options{SearchPatterns: []string{"("}, Regex: true}, wantErr: "invalid regular expression"},
+		{name: "invalid JSON condition", opts: Options{SearchPatterns: []string{"level"}, JSONFields: true}, wantErr: "invalid JSON field condition"},
+		{name: "regex and JSON fields", opts: Options{SearchPatterns: []string{"a=b"}, Regex: true, JSONFields: true}, wantErr: "can't be regular expressions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Compile()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tt.opts.matchers) != 1 || !reflect.DeepEqual(tt.opts.matchers[0], tt.want) {
+				t.Errorf("matchers = %#v, want [%#v]", tt.opts.matchers, tt.want)
+			}
+		})
+	}
+}
+
+func TestWholeLineMatcher(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		regex     bool
+		line      string
+		wantMatch bool
+	}{
+		{name: "equal line", pattern: "completed", line: "completed\n", wantMatch: true},
+		{name: "substring doesn't match", pattern: "completed", line: "not completed\n"},
+		{name: "trailing carriage return is trimmed", pattern: "completed", line: "completed\r\n", wantMatch: true},
+		{name: "surrounding whitespace is trimmed", pattern: "completed", line: "  completed\t\n", wantMatch: true},
+		{name: "inner whitespace counts", pattern: "job completed", line: "job  completed\n"},
+		{name: "regex fully matches", pattern: `job \d+ completed`, regex: true, line: "job 12 completed\r\n", wantMatch: true},
+		{name: "regex is anchored", pattern: `job \d+ completed`, regex: true, line: "job 12 completed later\n"},
+		{name: "regex alternation is anchored as a whole", pattern: `ok|done`, regex: true, line: "not ok\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{SearchPatterns: []string{tt.pattern}, Regex: tt.regex, WholeLine: true}
+			if err := opts.Compile(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(opts.matchPatterns(tt.line)) > 0; got != tt.wantMatch {
+				t.Errorf("match = %v, want %v", got, tt.wantMatch)
+			}
+		})
+	}
+
+	if got := (Options{SearchPatterns: []string{"completed"}, WholeLine: true}).HighlightMatches("completed\r", "[", "]"); got != "[completed]\r" {
+		t.Errorf("highlight = %q", got)
+	}
+	opts := Options{SearchPatterns: []string{"level=error"}, JSONFields: true, WholeLine: true}
+	if err := opts.Compile(); err == nil {
+		t.Errorf("expected whole-line JSON field conditions to be rejected")
+	}
+}
+
+func TestJSONFieldMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		line    string
+		want    bool
+	}{
+		{name: "equal and contains", pattern: "level=error,msg~timeout", line: `{"level":"error","msg":"db timeout after 5s"}`, want: true},
+		{name: "value differs", pattern: "level=error,msg~timeout", line: `{"level":"info","msg":"db timeout after 5s"}`},
+		{name: "substring is not equal", pattern: "level=err", line: `{"level":"error"}`},
+		{name: "nested number", pattern: "error.code=500", line: `{"error":{"code":500}}`, want: true},
+		{name: "boolean", pattern: "ready=true", line: `{"ready":true}`, want: true},
+		{name: "missing field", pattern: "level=error", line: `{"msg":"level=error"}`},
+		{name: "not JSON", pattern: "level=error", line: "level=error msg=timeout"},
+		{name: "invalid JSON", pattern: "level=error", line: `{"level":"error"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := newJSONFieldMatcher(tt.pattern)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := matcher.Match(tt.line + "\n"); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnSelectedStream(t *testing.T) {
+	for _, tt := range []struct {
+		stream LogStream
+		line   string
+		want   bool
+	}{
+		{stream: StreamStderr, line: `{"stream":"stderr","log":"connection refused"}`, want: true},
+		{stream: StreamStderr, line: `{"stream":"stdout","log":"connection refused"}`, want: false},
+		{stream: StreamStdout, line: `{"stream":"stdout","log":"ok"}`, want: true},
+		{stream: StreamStderr, line: `{"log":"no stream field"}`, want: true},
+		{stream: StreamStderr, line: "plain text line", want: true},
+		{stream: StreamBoth, line: `{"stream":"stdout"}`, want: true},
+		{stream: "", line: `{"stream":"stdout"}`, want: true},
+	} {
+		if got := (Options{Stream: tt.stream}).onSelectedStream(tt.line); got != tt.want {
+			t.Errorf("stream %q, line %s: got %v, want %v", tt.stream, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSearchColor(t *testing.T) {
+	searcher := newTestSearcher("starting up\nlistening on port 8080\n", newTestPod("app", corev1.PodRunning, "app"))
+	var shown, matches bytes.Buffer
+	searcher.Stdout = &shown
+	searcher.MatchOutput = &matches
+	searcher.Color = true
+
+	_, err := searcher.Search(context.Background(), Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{`port \d+`},
+		Regex:          true,
+		ShowMatch:      true,
+		NoFollow:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := "app:L2: listening on \x1b[1;31mport 8080\x1b[0m"; !strings.Contains(shown.String(), want) {
+		t.Errorf("shown = %q, want it to contain %q", shown.String(), want)
+	}
+	if strings.Contains(matches.String(), "\x1b[") {
+		t.Errorf("match output = %q, want no color codes", matches.String())
+	}
+}
+
+func TestSearchDedup(t *testing.T) {
+	logs := "ERROR retry\nwaiting\nERROR retry\nERROR retry\nERROR giving up\n"
+	searcher := newTestSearcher(logs, newTestPod("app", corev1.PodRunning, "app"))
+	var shown bytes.Buffer
+	searcher.Stdout = &shown
+
+	result, err := searcher.Search(context.Background(), Options{
+		PodName:        "app",
+		Namespace:      "default",
+		SearchPatterns: []string{"ERROR"},
+		Count:          4,
+		ShowMatch:      true,
+		Dedup:          true,
+		NoFollow:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Found {
+		t.Errorf("found = false, want true since every repeat still counts")
+	}
+
+	want := "app:L1: ERROR retry\napp:L1: ERROR retry (x3)\napp:L5: ERROR giving up\n"
+	if shown.String() != want {
+		t.Errorf("shown = %q, want %q", shown.String(), want)
+	}
+}
@@ -0,0 +1,1013 @@
+package needle
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// logLine is a single read from a log stream
+type logLine struct {
+	text string
+	err  error
+}
+
+// podMatch is the outcome of searching the logs of a pod or container
+type podMatch struct {
+	found bool
+	// The line that completed the match
+	line string
+	// Set when a timeout ended the search before a match
+	timedOut bool
+	// 1-based number of the matched line in its log stream, and when it was read
+	lineNumber int
+	matchedAt  time.Time
+	// Lines matched with StreamMatches
+	matches int
+	// Set when a stream reached MaxLogLines without a match, which ends the pod's search
+	lineLimit bool
+	// The container whose logs matched, when known
+	container string
+}
+
+// streamedMatches collects the lines of a pod matched with StreamMatches, across its containers
+// and reopened streams
+type streamedMatches struct {
+	mu    sync.Mutex
+	count int
+	first podMatch
+}
+
+// Record a matching line with its number in the stream
+func (m *streamedMatches) record(line string, lineNumber int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.count == 0 {
+		m.first = podMatch{found: true, line: line, lineNumber: lineNumber, matchedAt: time.Now()}
+	}
+	m.count++
+}
+
+// The pod's outcome: found once any line matched
+func (m *streamedMatches) match() podMatch {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	match := m.first
+	match.matches = m.count
+	return match
+}
+
+// numberedLine is a log line with its 1-based number in the stream
+type numberedLine struct {
+	number int
+	text   string
+}
+
+// ErrMultipleContainers is returned when a pod has several containers and none was selected
+var ErrMultipleContainers = errors.New("multiple containers")
+
+// errStreamIdle is returned when a log stream delivers no data within the read timeout
+var errStreamIdle = errors.New("no log output received within the read timeout")
+
+// errStreamEnded is returned when a followed log stream reaches its end, which is not an error once
+// it can't be reopened
+var errStreamEnded = errors.New("log stream ended")
+
+// errByteLimit is returned once the log streams of a container delivered Options.LimitBytes bytes
+var errByteLimit = errors.New("log byte limit reached")
+
+// byteLimitReader stops a log stream once the bytes left for its container run out
+type byteLimitReader struct {
+	r         io.Reader
+	remaining *atomic.Int64
+}
+
+func (l byteLimitReader) Read(p []byte) (int, error) {
+	remaining := l.remaining.Load()
+	if remaining <= 0 {
+		return 0, errByteLimit
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining.Add(-int64(n))
+	return n, err
+}
+
+// Bound a log stream by the bytes left, when limited
+func limitStream(r io.Reader, remaining *atomic.Int64) io.Reader {
+	if remaining == nil {
+		return r
+	}
+	return byteLimitReader{r: r, remaining: remaining}
+}
+
+// reconnectBackoff is the delay before reopening a dropped log stream, multiplied by the attempt number
+const reconnectBackoff = time.Second
+
+// restartPollInterval is how often a restarting container is checked for its new instance
+const restartPollInterval = 2 * time.Second
+
+// Search for pattern in logs of a single pod
+func (s *Searcher) searchSinglePodLogs(ctx context.Context, podName string, opts Options) (podMatch, error) {
+	if opts.StreamMatches {
+		opts.streamed = &streamedMatches{}
+	}
+
+	var match podMatch
+	var err error
+	if opts.searchesSeveralContainers() {
+		match, err = s.searchAllContainerLogs(ctx, podName, opts)
+	} else {
+		match, err = s.searchContainerLogs(ctx, podName, opts)
+	}
+
+	// Streamed matches never end the search of the pod, which is found if any line matched
+	if opts.streamed != nil {
+		timedOut := match.timedOut
+		match = opts.streamed.match()
+		match.timedOut = timedOut
+	}
+	return match, err
+}
+
+// Search a pod within its own timeout, if any, and record it in the metrics; a pod reaching
+// its timeout did not match
+func (s *Searcher) searchPodWithTimeout(ctx context.Context, podName string, opts Options) (podMatch, error) {
+	if opts.PodTimeout <= 0 {
+		match, err := s.searchSinglePodLogs(ctx, podName, opts)
+		match.timedOut = !match.found && err == nil && ctx.Err() == context.DeadlineExceeded
+		s.Metrics.observePod(match.found, false)
+		return match, err
+	}
+
+	podCtx, cancel := context.WithTimeout(ctx, opts.PodTimeout)
+	defer cancel()
+	match, err := s.searchSinglePodLogs(podCtx, podName, opts)
+	timedOut := podCtx.Err() != nil && ctx.Err() == nil
+	s.Metrics.observePod(match.found, timedOut)
+	if err != nil && timedOut {
+		err = nil
+	}
+	match.timedOut = !match.found && err == nil && (timedOut || ctx.Err() == context.DeadlineExceeded)
+	return match, err
+}
+
+// Search several containers of a pod concurrently, stopping as soon as one of them matches
+func (s *Searcher) searchAllContainerLogs(ctx context.Context, podName string, opts Options) (podMatch, error) {
+	pod, err := retryAPI(ctx, s, opts, func() (*corev1.Pod, error) {
+		return s.client.CoreV1().Pods(opts.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return podMatch{}, lookupError("pod", podName, opts.Namespace, err)
+	}
+
+	// Pick the containers to search, each with its own options
+	var targets []Options
+	switch {
+	case opts.AllContainers:
+		for _, container := range pod.Spec.Containers {
+			containerOpts := opts
+			containerOpts.ContainerName = container.Name
+			targets = append(targets, containerOpts)
+		}
+		// Debug containers added with kubectl debug
+		for _, container := range pod.Spec.EphemeralContainers {
+			containerOpts := opts
+			containerOpts.ContainerName = container.Name
+			containerOpts.ephemeralContainer = true
+			targets = append(targets, containerOpts)
+		}
+	case len(opts.Containers) > 0:
+		if err := checkContainersExist(pod, opts.Containers); err != nil {
+			return podMatch{}, err
+		}
+		for _, containerName := range opts.Containers {
+			containerOpts := opts
+			containerOpts.ContainerName = containerName
+			targets = append(targets, containerOpts)
+		}
+	default:
+		// Only the selected container; an ambiguous selection is reported when its stream is opened
+		containerOpts := opts
+		if containerOpts.ContainerName == "" && len(pod.Spec.Containers) == 1 {
+			containerOpts.ContainerName = pod.Spec.Containers[0].Name
+		}
+		targets = append(targets, containerOpts)
+	}
+	if opts.InitContainers {
+		for _, container := range pod.Spec.InitContainers {
+			containerOpts := opts
+			containerOpts.ContainerName = container.Name
+			containerOpts.initContainer = true
+			targets = append(targets, containerOpts)
+		}
+	}
+
+	containerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type containerResult struct {
+		containerName string
+		match         podMatch
+		err           error
+	}
+	results := make(chan containerResult, len(targets))
+	for _, containerOpts := range targets {
+		go func(containerOpts Options) {
+			match, err := s.searchContainerLogs(containerCtx, podName, containerOpts)
+			results <- containerResult{containerName: containerOpts.ContainerName, match: match, err: err}
+		}(containerOpts)
+	}
+
+	var errs []string
+	for range targets {
+		result := <-results
+		if result.match.found {
+			result.match.container = result.containerName
+			return result.match, nil
+		}
+		if result.err != nil {
+			errs = append(errs, fmt.Sprintf("container '%s': %v", result.containerName, result.err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return podMatch{}, fmt.Errorf("failed to search %d of %d containers in pod '%s': %s",
+			len(errs), len(targets), podName, strings.Join(errs, "; "))
+	}
+	return podMatch{}, nil
+}
+
+// Check that every named container exists in the pod
+func checkContainersExist(pod *corev1.Pod, containerNames []string) error {
+	var available, missing []string
+	for _, container := range pod.Spec.Containers {
+		available = append(available, container.Name)
+	}
+	for _, name := range containerNames {
+		if !slices.Contains(available, name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("container(s) '%s' not found in pod '%s' (containers: %s)",
+			strings.Join(missing, "', '"), pod.Name, strings.Join(available, ", "))
+	}
+	return nil
+}
+
+// Search for pattern in logs of one container of a pod
+func (s *Searcher) searchContainerLogs(ctx context.Context, podName string, opts Options) (podMatch, error) {
+	// With TailThenFollow the log history is read to its end before new lines are followed
+	historyOpts := opts
+	var followFrom *metav1.Time
+	if opts.TailThenFollow && !opts.NoFollow && !opts.Previous {
+		historyOpts.NoFollow = true
+		now := metav1.Now()
+		followFrom = &now
+	}
+
+	podLogs, pod, err := s.openPodLogStream(ctx, podName, historyOpts, nil)
+	if err != nil {
+		return podMatch{}, err
+	}
+
+	containerName := targetContainerName(pod, opts)
+	restartCount := containerRestartCount(pod, containerName)
+	counts := make([]int, len(opts.SearchPatterns))
+	// The logs of a terminating pod end for good once its containers stop, and those of a pod
+	// that isn't running are only read to their end
+	opts.podCompleted = podCompleted(pod) || pod.DeletionTimestamp != nil ||
+		(opts.IncludeNotRunning && pod.Status.Phase != corev1.PodRunning)
+	reconnects := 0
+
+	// Lines logged before a restart are only in the previous instance's logs
+	if restartCount > 0 && !opts.Previous {
+		if opts.SearchPreviousOnRestart {
+			match, err := s.searchPreviousInstance(ctx, podName, containerName, restartCount, opts, counts)
+			if err != nil || match.found || match.lineLimit {
+				podLogs.Close()
+				return match, err
+			}
+		} else {
+			s.warnf(VerbosityMatches, "Warning: container '%s' in pod '%s' has restarted (restarts: %d), lines logged by earlier instances are not searched (see -previous)\n",
+				containerName, podName, restartCount)
+		}
+	}
+
+	// Bytes left to read from this container's streams with LimitBytes
+	var remaining *atomic.Int64
+	if opts.LimitBytes > 0 {
+		remaining = new(atomic.Int64)
+		remaining.Store(opts.LimitBytes)
+	}
+
+	if followFrom != nil {
+		match, err := s.scanLogStream(ctx, limitStream(podLogs, remaining), podName, containerName, historyOpts, counts)
+		podLogs.Close()
+		if err != nil || match.found || match.lineLimit || ctx.Err() != nil || opts.podCompleted || (remaining != nil && remaining.Load() <= 0) {
+			return match, err
+		}
+
+		// Follow the lines logged since the history was requested
+		s.logf(VerbosityMatches, "--- End of log history of %s, following new lines ---\n", describeLogSource(podName, opts))
+		podLogs, _, err = s.openPodLogStream(ctx, podName, opts, followFrom)
+		if err != nil {
+			return podMatch{}, err
+		}
+	}
+
+	for {
+		match, err := s.scanLogStream(ctx, limitStream(podLogs, remaining), podName, containerName, opts, counts)
+		podLogs.Close()
+		streamEnded := metav1.Now()
+
+		var sinceTime *metav1.Time
+		switch {
+		case err == nil:
+			return match, nil
+
+		case s.podHasCompleted(ctx, podName, opts):
+			// The pod finished while it was searched, ending its logs without a match
+			return podMatch{}, nil
+
+		case errors.Is(err, errStreamIdle) && s.containerStillRunning(ctx, podName, containerName, restartCount, opts):
+			// The stream went silent while the container keeps running, which quiet containers do:
+			// reopen it, continuing from when data stopped arriving, without using up MaxReconnects
+			s.logf(VerbosityLogs, "No log output from pod '%s' within %s, reopening log stream\n", podName, opts.ReadTimeout)
+			idleSince := metav1.NewTime(time.Now().Add(-opts.ReadTimeout))
+			sinceTime = &idleSince
+
+		case reconnects < opts.MaxReconnects && s.containerStillRunning(ctx, podName, containerName, restartCount, opts):
+			// The API server or a proxy closed the stream early: reopen it where it stopped
+			reconnects++
+			s.logf(VerbosityMatches, "Log stream of pod '%s' dropped (%v), reconnecting (%d/%d)\n",
+				podName, err, reconnects, opts.MaxReconnects)
+			select {
+			case <-ctx.Done():
+				return podMatch{}, nil
+			case <-time.After(time.Duration(reconnects) * reconnectBackoff):
+			}
+			sinceTime = &streamEnded
+
+		case !opts.ResetOnRestart:
+			return podMatch{}, streamEndError(err)
+
+		default:
+			// The stream ended: if the container restarted, start over on the new instance
+			newRestartCount, waitErr := s.waitForContainerRestart(ctx, podName, containerName, restartCount, opts)
+			if ctx.Err() != nil {
+				// Timeout reached while waiting for the new instance
+				return podMatch{}, nil
+			}
+			if waitErr != nil {
+				return podMatch{}, streamEndError(err)
+			}
+
+			s.logf(VerbosityMatches, "Container '%s' in pod '%s' restarted (restarts: %d -> %d), resetting search to the new instance\n",
+				containerName, podName, restartCount, newRestartCount)
+			restartCount = newRestartCount
+			// Patterns seen by the dead instance don't count
+			counts = make([]int, len(opts.SearchPatterns))
+		}
+
+		podLogs, _, err = s.openPodLogStream(ctx, podName, opts, sinceTime)
+		if err != nil {
+			return podMatch{}, err
+		}
+	}
+}
+
+// Search the logs of the previous instance of a restarted container, counting its matches in counts
+func (s *Searcher) searchPreviousInstance(ctx context.Context, podName, containerName string, restartCount int32, opts Options, counts []int) (podMatch, error) {
+	s.logf(VerbosityMatches, "Container '%s' in pod '%s' has restarted (restarts: %d), searching its previous instance first\n",
+		containerName, podName, restartCount)
+	opts.Previous = true
+	podLogs, _, err := s.openPodLogStream(ctx, podName, opts, nil)
+	if err != nil {
+		return podMatch{}, err
+	}
+	defer podLogs.Close()
+	return s.scanLogStream(ctx, podLogs, podName, containerName, opts, counts)
+}
+
+// Read a log stream line by line until the patterns are found, the stream ends or the context is done.
+// Matches are counted per pattern in counts so progress survives reopening the stream.
+func (s *Searcher) scanLogStream(ctx context.Context, podLogs io.Reader, podName, containerName string, opts Options, counts []int) (podMatch, error) {
+	// Read in the background so a silent stream can't block past the timeout
+	lines := make(chan logLine)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		reader := bufio.NewReader(podLogs)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil && line != "" {
+				// The last line of a stream may lack its newline: search it before the error
+				select {
+				case lines <- logLine{text: line}:
+				case <-done:
+					return
+				}
+				line = ""
+			}
+			select {
+			case lines <- logLine{text: line, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Detect streams that stay open without delivering any data
+	var idleTimer *time.Timer
+	var idle <-chan time.Time
+	if opts.ReadTimeout > 0 {
+		idleTimer = time.NewTimer(opts.ReadTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	// 1-based number of the last line read from this stream
+	lineNumber := 0
+	// Recent lines kept for the context printed before a match
+	var beforeLines []numberedLine
+	// Lines still to print after the last match, and whether the patterns were already found
+	afterRemaining := 0
+	satisfied := false
+	// The line that completed the match, once the patterns are found
+	var match podMatch
+	// Recent lines searched by multiline patterns
+	window := multilineWindow{max: opts.multilineWindow()}
+	// Runs of repeated debug and shown lines, collapsed with Dedup
+	var debugRepeats, matchRepeats *repeatedLine
+	if opts.Dedup {
+		debugRepeats = &repeatedLine{w: s.Stdout}
+		matchRepeats = &repeatedLine{w: s.Stdout}
+		defer debugRepeats.flush()
+		defer matchRepeats.flush()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Timeout reached; patterns found before reading the trailing context still count
+			return match, nil
+		case <-idle:
+			if satisfied {
+				return match, nil
+			}
+			return podMatch{}, errStreamIdle
+		case l := <-lines:
+			if l.err != nil {
+				// The trailing context ends with the stream
+				if satisfied {
+					return match, nil
+				}
+				// Check if context was canceled (timeout)
+				if ctx.Err() != nil {
+					return podMatch{}, nil
+				}
+				if l.err == errByteLimit {
+					s.logf(VerbosityMatches, "Read %d bytes from %s without a match, stopping\n", opts.LimitBytes, describeLogSource(podName, opts))
+					return podMatch{}, nil
+				}
+				if l.err == io.EOF {
+					// Logs that aren't followed, or of a terminated instance, an init container or a completed pod,
+					// end at EOF without a match
+					if opts.NoFollow || opts.Previous || opts.initContainer || opts.podCompleted {
+						return podMatch{}, nil
+					}
+					// A followed stream may be reopened
+					return podMatch{}, errStreamEnded
+				}
+				return podMatch{}, fmt.Errorf("error reading logs: %w", l.err)
+			}
+			if idleTimer != nil {
+				idleTimer.Reset(opts.ReadTimeout)
+			}
+			line := l.text
+			lineNumber++
+
+			// Stop a stream that reached its line cap without a match
+			if opts.MaxLogLines > 0 && lineNumber > opts.MaxLogLines && !satisfied {
+				s.logf(VerbosityMatches, "Read %d lines from %s without a match, stopping\n", opts.MaxLogLines, describeLogSource(podName, opts))
+				return podMatch{lineLimit: true}, nil
+			}
+
+			// Report how far back the available logs go
+			if lineNumber == 1 && opts.FromStart && opts.Timestamps {
+				if timestamp, _, ok := splitTimestamp(line); ok {
+					s.warnf(VerbosityDiscovery, "Earliest log line available from %s is from %s\n",
+						describeLogSource(podName, opts), timestamp.UTC().Format(time.RFC3339))
+				}
+			}
+
+			// Print every log line at the highest verbosity
+			if s.Verbosity >= VerbosityLogs {
+				text := strings.TrimSuffix(line, "\n")
+				if !debugRepeats.repeat(fmt.Sprintf("[%s]", logSource(podName, opts)), text) {
+					s.logf(VerbosityLogs, "[%s] %s\n", logSource(podName, opts), s.highlight(opts, text))
+				}
+			}
+
+			// Once the patterns are found, only the trailing context is left to print
+			if satisfied {
+				s.printContextLine(podName, opts, numberedLine{lineNumber, line})
+				afterRemaining--
+				if afterRemaining == 0 {
+					return match, nil
+				}
+				continue
+			}
+
+			// Check which search patterns the line, or the window ending with it, contains; lines of
+			// the other output stream are not tested
+			tested := opts.matchText(line)
+			var matched []int
+			if opts.onSelectedStream(tested) {
+				if opts.Multiline {
+					window.add(tested)
+					tested = window.text
+				}
+				matched = opts.matchPatterns(tested)
+				if opts.Multiline && len(matched) > 0 {
+					window.reset()
+				}
+			}
+			// Matches older than the Within window don't count
+			if len(matched) > 0 && !opts.withinWindow(line, time.Now()) {
+				matched = nil
+			}
+
+			// Print every matching line and keep reading with StreamMatches
+			if opts.streamed != nil {
+				if len(matched) > 0 {
+					s.streamMatch(podName, containerName, opts, lineNumber, line)
+				}
+				continue
+			}
+			firstMatch := -1
+			for _, i := range matched {
+				count := opts.recordMatch(counts, i)
+				if count == 0 {
+					// The pattern already reached its count
+					continue
+				}
+				if firstMatch < 0 {
+					firstMatch = i
+				}
+				if resourceType, _ := opts.Resource(); count == opts.countThreshold() && (s.Verbosity >= VerbosityLogs || resourceType != "" || len(opts.Targets) > 0) {
+					if count > 1 {
+						s.logf(VerbosityMatches, "Found pattern '%s' %d times in %s\n", opts.SearchPatterns[i], count, describeLogSource(podName, opts))
+					} else {
+						s.logf(VerbosityMatches, "Found pattern '%s' in %s\n", opts.SearchPatterns[i], describeLogSource(podName, opts))
+					}
+				}
+			}
+
+			if firstMatch >= 0 {
+				s.writeMatchOutput(podName, containerName, opts, line)
+			}
+
+			// Echo the matching line, with its surrounding context, if requested
+			if firstMatch >= 0 && opts.ShowMatch {
+				for _, before := range beforeLines {
+					s.printContextLine(podName, opts, before)
+				}
+				beforeLines = nil
+				label := fmt.Sprintf("%s:L%d:", logSource(podName, opts), lineNumber)
+				if !matchRepeats.repeat(label, strings.TrimRight(line, "\r\n")) {
+					s.printMatch(podName, opts, lineNumber, line, tested, firstMatch)
+				}
+				afterRemaining = opts.AfterLines
+			} else if afterRemaining > 0 {
+				s.printContextLine(podName, opts, numberedLine{lineNumber, line})
+				afterRemaining--
+			} else if opts.BeforeLines > 0 {
+				beforeLines = append(beforeLines, numberedLine{lineNumber, line})
+				if len(beforeLines) > opts.BeforeLines {
+					beforeLines = beforeLines[1:]
+				}
+			}
+
+			if patternsSatisfied(opts.patternsFound(counts), opts.MatchMode) {
+				match = podMatch{found: true, line: strings.TrimRight(line, "\r\n"), lineNumber: lineNumber, matchedAt: time.Now()}
+				// Keep reading for the trailing context before reporting the match
+				if afterRemaining > 0 {
+					satisfied = true
+					continue
+				}
+				return match, nil
+			}
+		}
+	}
+}
+
+// Error of a stream that can't be reopened: reaching its end, or going silent once its container
+// stopped, only means the patterns weren't found
+func streamEndError(err error) error {
+	if errors.Is(err, errStreamEnded) || errors.Is(err, errStreamIdle) {
+		return nil
+	}
+	return err
+}
+
+// Print a matching line with its line number, and in regex mode the matched part of the text
+// the pattern was tested against
+func (s *Searcher) printMatch(podName string, opts Options, lineNumber int, line, tested string, patternIndex int) {
+	line = s.highlight(opts, strings.TrimRight(line, "\r\n"))
+	if matcher, ok := opts.patternMatchers()[patternIndex].(regexMatcher); ok {
+		fmt.Fprintf(s.Stdout, "%s:L%d: %s (match: %q)\n", logSource(podName, opts), lineNumber, line,
+			matcher.re.FindString(tested))
+		return
+	}
+	fmt.Fprintf(s.Stdout, "%s:L%d: %s\n", logSource(podName, opts), lineNumber, line)
+}
+
+// Print a line matched with StreamMatches, prefixed by its pod, and record it
+func (s *Searcher) streamMatch(podName, containerName string, opts Options, lineNumber int, line string) {
+	line = strings.TrimRight(line, "\r\n")
+	opts.streamed.record(line, lineNumber)
+	s.writeMatchOutput(podName, containerName, opts, line)
+	fmt.Fprintf(s.Stdout, "[%s] %s\n", logSource(podName, opts), s.highlight(opts, line))
+}
+
+// Record a matching line in MatchOutput, prefixed with the time it was read, its pod and container
+func (s *Searcher) writeMatchOutput(podName, containerName string, opts Options, line string) {
+	if s.MatchOutput == nil {
+		return
+	}
+	fmt.Fprintf(s.MatchOutput, "%s %s/%s/%s: %s\n", time.Now().UTC().Format(time.RFC3339), opts.Namespace, podName,
+		containerName, strings.TrimRight(line, "\r\n"))
+}
+
+// repeatedLine tracks a run of identical printed lines for Options.Dedup; a nil *repeatedLine
+// never reports repeats
+type repeatedLine struct {
+	w     io.Writer
+	label string
+	text  string
+	count int
+}
+
+// Check whether text repeats the last printed line, counting it if so. Otherwise the finished run
+// is reported and a new one starts with text, labeled for its report.
+func (r *repeatedLine) repeat(label, text string) bool {
+	if r == nil {
+		return false
+	}
+	if r.count > 0 && text == r.text {
+		r.count++
+		return true
+	}
+	r.flush()
+	r.label, r.text, r.count = label, text, 1
+	return false
+}
+
+// Print the line of the current run with its count, if it repeated
+func (r *repeatedLine) flush() {
+	if r.count > 1 {
+		fmt.Fprintf(r.w, "%s %s (x%d)\n", r.label, r.text, r.count)
+	}
+	r.count = 0
+}
+
+// Highlight the matches in a line printed to Stdout when Color is set
+func (s *Searcher) highlight(opts Options, line string) string {
+	if !s.Color {
+		return line
+	}
+	return opts.HighlightMatches(line, ansiHighlight, ansiReset)
+}
+
+// Print a line of context around a match
+func (s *Searcher) printContextLine(podName string, opts Options, line numberedLine) {
+	fmt.Fprintf(s.Stdout, "%s-L%d- %s\n", logSource(podName, opts), line.number, strings.TrimRight(line.text, "\r\n"))
+}
+
+// Label log lines with the pod, prefixed by its namespace when searching all namespaces and
+// followed by the container when several are searched
+func logSource(podName string, opts Options) string {
+	source := podDisplayName(opts.Namespace, podName, opts)
+	if opts.searchesSeveralContainers() {
+		source += "/" + opts.ContainerName
+	}
+	return source
+}
+
+// Describe the pod, and the container when several are searched, for user-facing messages
+func describeLogSource(podName string, opts Options) string {
+	podName = podDisplayName(opts.Namespace, podName, opts)
+	if opts.initContainer {
+		return fmt.Sprintf("init container '%s' of pod '%s'", opts.ContainerName, podName)
+	}
+	if opts.ephemeralContainer {
+		return fmt.Sprintf("ephemeral container '%s' of pod '%s'", opts.ContainerName, podName)
+	}
+	if opts.searchesSeveralContainers() {
+		return fmt.Sprintf("container '%s' of pod '%s'", opts.ContainerName, podName)
+	}
+	return fmt.Sprintf("pod '%s'", podName)
+}
+
+// Qualify a pod name with its namespace when searching several namespaces
+func podDisplayName(namespace, podName string, opts Options) string {
+	if opts.spansNamespaces() {
+		return namespace + "/" + podName
+	}
+	return podName
+}
+
+// Wait for a container to come back running with a higher restart count
+func (s *Searcher) waitForContainerRestart(ctx context.Context, podName, containerName string, restartCount int32, opts Options) (int32, error) {
+	ticker := time.NewTicker(restartPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := s.client.CoreV1().Pods(opts.Namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return 0, lookupError("pod", podName, opts.Namespace, err)
+		}
+
+		status := findContainerStatus(pod, containerName)
+		if status == nil {
+			return 0, fmt.Errorf("no status found for container '%s' in pod '%s'", containerName, podName)
+		}
+
+		// A running container that did not restart means the stream ended for another reason
+		if status.State.Running != nil {
+			if status.RestartCount > restartCount {
+				return status.RestartCount, nil
+			}
+			return 0, fmt.Errorf("container '%s' in pod '%s' did not restart", containerName, podName)
+		}
+
+		// The container is terminated or waiting to be restarted
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check whether a pod has run to completion, successfully or not
+func podCompleted(pod *corev1.Pod) bool {
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// Check whether a container is still running the same instance, meaning its log stream was
+// closed by the API server or a proxy rather than because the container exited
+func (s *Searcher) containerStillRunning(ctx context.Context, podName, containerName string, restartCount int32, opts Options) bool {
+	pod, err := s.client.CoreV1().Pods(opts.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	status := findContainerStatus(pod, containerName)
+	return status != nil && status.State.Running != nil && status.RestartCount == restartCount
+}
+
+// Check whether a pod has completed, for example after its log stream ended
+func (s *Searcher) podHasCompleted(ctx context.Context, podName string, opts Options) bool {
+	pod, err := s.client.CoreV1().Pods(opts.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	return err == nil && podCompleted(pod)
+}
+
+// Resolve the name of the container whose logs are searched
+func targetContainerName(pod *corev1.Pod, opts Options) string {
+	if opts.ContainerName != "" {
+		return opts.ContainerName
+	}
+	return pod.Spec.Containers[0].Name
+}
+
+// Find the status of a container or init container in a pod
+func findContainerStatus(pod *corev1.Pod, containerName string) *corev1.ContainerStatus {
+	for i := range pod.Status.ContainerStatuses {
+		if pod.Status.ContainerStatuses[i].Name == containerName {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	for i := range pod.Status.InitContainerStatuses {
+		if pod.Status.InitContainerStatuses[i].Name == containerName {
+			return &pod.Status.InitContainerStatuses[i]
+		}
+	}
+	for i := range pod.Status.EphemeralContainerStatuses {
+		if pod.Status.EphemeralContainerStatuses[i].Name == containerName {
+			return &pod.Status.EphemeralContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
+// Describe why a container that never started is waiting, e.g. "ImagePullBackOff (Back-off
+// pulling image)", or return "" when it has logs to stream
+func containerWaitingReason(pod *corev1.Pod, containerName string) string {
+	status := findContainerStatus(pod, containerName)
+	if status == nil || status.State.Waiting == nil || status.RestartCount > 0 || status.LastTerminationState.Terminated != nil {
+		return ""
+	}
+	reason := status.State.Waiting.Reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	if status.State.Waiting.Message != "" {
+		reason += " (" + status.State.Waiting.Message + ")"
+	}
+	return reason
+}
+
+// Poll a pod until the searched container is ready or the pod completed, failing with the
+// container's state when ctx is done first
+func (s *Searcher) waitForContainerReady(ctx context.Context, pod *corev1.Pod, opts Options) (*corev1.Pod, error) {
+	containerName := targetContainerName(pod, opts)
+	ticker := time.NewTicker(restartPollInterval)
+	defer ticker.Stop()
+
+	for waited := false; ; waited = true {
+		if status := findContainerStatus(pod, containerName); podCompleted(pod) || (status != nil && status.Ready) {
+			return pod, nil
+		}
+		if !waited {
+			s.logf(VerbosityMatches, "Waiting for container '%s' in pod '%s' to become ready\n", containerName, pod.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			if reason := containerWaitingReason(pod, containerName); reason != "" {
+				return nil, fmt.Errorf("container '%s' in pod '%s' is still Waiting: %s", containerName, pod.Name, reason)
+			}
+			return nil, fmt.Errorf("container '%s' in pod '%s' did not become ready", containerName, pod.Name)
+		case <-ticker.C:
+		}
+
+		latest, err := s.client.CoreV1().Pods(opts.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil && ctx.Err() == nil {
+			return nil, lookupError("pod", pod.Name, opts.Namespace, err)
+		}
+		if err == nil {
+			pod = latest
+		}
+	}
+}
+
+// Get the restart count of a container, or zero if it has no status yet
+func containerRestartCount(pod *corev1.Pod, containerName string) int32 {
+	if status := findContainerStatus(pod, containerName); status != nil {
+		return status.RestartCount
+	}
+	return 0
+}
+
+// Validate a pod and its container, then open a follow stream of its logs, optionally starting at sinceTime
+func (s *Searcher) openPodLogStream(ctx context.Context, podName string, opts Options, sinceTime *metav1.Time) (io.ReadCloser, *corev1.Pod, error) {
+	// Check if pod exists
+	pod, err := retryAPI(ctx, s, opts, func() (*corev1.Pod, error) {
+		return s.client.CoreV1().Pods(opts.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, nil, lookupError("pod", podName, opts.Namespace, err)
+	}
+
+	// Skip terminating pods unless they are searched until their containers stop
+	if pod.DeletionTimestamp != nil && !opts.IncludeTerminating {
+		return nil, nil, fmt.Errorf("pod '%s' is being terminated (has deletion timestamp, see -include-terminating), skipping log search", podName)
+	}
+
+	// Optionally wait for the container to become ready rather than failing on a starting pod
+	if opts.WaitForReady && !opts.Previous && !opts.initContainer && sinceTime == nil {
+		if pod, err = s.waitForContainerReady(ctx, pod, opts); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// A container that never started has no logs yet: say why rather than failing to stream
+	if !opts.Previous && (opts.ContainerName != "" || len(pod.Spec.Containers) == 1) {
+		containerName := targetContainerName(pod, opts)
+		if reason := containerWaitingReason(pod, containerName); reason != "" {
+			return nil, nil, fmt.Errorf("container '%s' in pod '%s' is Waiting: %s", containerName, podName, reason)
+		}
+	}
+
+	// Init containers run, and can be searched, before the pod is running; completed pods
+	// keep their logs
+	if pod.Status.Phase != corev1.PodRunning && !opts.initContainer && !podCompleted(pod) && !opts.IncludeNotRunning {
+		return nil, nil, fmt.Errorf("pod '%s' is not running (phase: %s), skipping log search", podName, pod.Status.Phase)
+	}
+
+	// Validate container name if provided
+	if opts.ContainerName != "" {
+		containerExists := false
+		for _, container := range pod.Spec.Containers {
+			if container.Name == opts.ContainerName {
+				containerExists = true
+				break
+			}
+		}
+		if opts.initContainer {
+			for _, container := range pod.Spec.InitContainers {
+				if container.Name == opts.ContainerName {
+					containerExists = true
+					break
+				}
+			}
+		}
+		if opts.ephemeralContainer {
+			for _, container := range pod.Spec.EphemeralContainers {
+				if container.Name == opts.ContainerName {
+					containerExists = true
+					break
+				}
+			}
+		}
+		if !containerExists {
+			return nil, nil, fmt.Errorf("container '%s' not found in pod '%s'", opts.ContainerName, podName)
+		}
+	} else if len(pod.Spec.Containers) > 1 {
+		// If container name is not provided and pod has multiple containers
+		containerNames := []string{}
+		for _, container := range pod.Spec.Containers {
+			containerNames = append(containerNames, container.Name)
+		}
+		if !opts.DefaultFirstContainer {
+			return nil, nil, fmt.Errorf("pod '%s' has %w (%s), please specify a container name",
+				podName, ErrMultipleContainers, strings.Join(containerNames, ", "))
+		}
+		// Search the first container, reporting the choice when the first stream is opened
+		opts.ContainerName = containerNames[0]
+		if sinceTime == nil && !opts.Previous {
+			s.warnf(VerbosityDiscovery, "Defaulted to container '%s' of pod '%s' out of: %s\n",
+				opts.ContainerName, podName, strings.Join(containerNames, ", "))
+		}
+	}
+
+	// A terminated instance only exists once the container has restarted
+	if opts.Previous {
+		containerName := targetContainerName(pod, opts)
+		if containerRestartCount(pod, containerName) == 0 {
+			return nil, nil, fmt.Errorf("container '%s' in pod '%s' has no previous instance (it has not restarted)", containerName, podName)
+		}
+	}
+
+	// Set up log options; the API can't follow the logs of a terminated instance
+	podLogOptions := corev1.PodLogOptions{
+		Follow:     !opts.Previous && !opts.NoFollow,
+		Previous:   opts.Previous,
+		Timestamps: opts.Timestamps,
+		Container:  opts.ContainerName,
+		SinceTime:  sinceTime,
+	}
+	if opts.LimitBytes > 0 {
+		podLogOptions.LimitBytes = &opts.LimitBytes
+	}
+
+	// Bound the history of the initial stream; a reopened stream resumes at sinceTime instead
+	if sinceTime == nil {
+		if opts.FromStart && !pod.CreationTimestamp.IsZero() {
+			podLogOptions.SinceTime = &pod.CreationTimestamp
+			s.warnf(VerbosityDiscovery, "Reading logs of %s from its creation at %s\n",
+				describeLogSource(podName, opts), pod.CreationTimestamp.UTC().Format(time.RFC3339))
+		}
+		if opts.Since > 0 {
+			sinceSeconds := int64(math.Ceil(opts.Since.Seconds()))
+			podLogOptions.SinceSeconds = &sinceSeconds
+		}
+		podLogOptions.TailLines = opts.TailLines
+	}
+
+	// Request logs
+	podLogs, err := s.streamLogs(ctx, s.streamClient(), opts.Namespace, podName, &podLogOptions)
+	if err != nil {
+		if opts.Previous {
+			return nil, nil, fmt.Errorf("failed to open logs of the previous instance of pod '%s': %w", podName, err)
+		}
+		return nil, nil, fmt.Errorf("failed to open log stream for pod '%s': %w", podName, err)
+	}
+
+	return podLogs, pod, nil
+}
+
+// OpenLogStream validates a pod and its container, then opens a follow stream of its logs
+func (s *Searcher) OpenLogStream(ctx context.Context, podName string, opts Options) (io.ReadCloser, error) {
+	podLogs, _, err := s.openPodLogStream(ctx, podName, opts, nil)
+	return podLogs, err
+}
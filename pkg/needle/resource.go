@@ -0,0 +1,517 @@
+package needle
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Search for pattern in logs of all pods in a resource
+func (s *Searcher) searchResourcePodLogs(ctx context.Context, resourceType ResourceType, resourceName string, opts Options) (Result, error) {
+	// Get pods from the resource
+	pods, err := s.getPodsFromResource(ctx, resourceType, resourceName, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.warnf(VerbosityDiscovery, "Found %d pods for %s '%s'\n", len(pods), resourceType, resourceName)
+
+	target := Target{Type: resourceType, Name: resourceName}
+	podTargets := make(map[string]Target, len(pods))
+	for _, pod := range pods {
+		podTargets[pod.Namespace+"/"+pod.Name] = target
+	}
+	return s.searchPods(ctx, []Target{target}, pods, podTargets, opts)
+}
+
+// Search for pattern in the logs of the resource's pods in every namespace matching
+// Options.NamespaceSelector, bounding the open log streams across all of them
+func (s *Searcher) searchSelectedNamespaces(ctx context.Context, opts Options) (Result, error) {
+	if opts.WatchPods {
+		return Result{}, fmt.Errorf("watching for new pods requires a single namespace")
+	}
+	pods, err := s.discoverSelectedNamespacePods(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	resourceType, resourceName := opts.Resource()
+	s.warnf(VerbosityDiscovery, "Found %d pods for %s '%s' in namespaces matching '%s'\n", len(pods), resourceType, resourceName, opts.NamespaceSelector)
+
+	target := Target{Type: resourceType, Name: resourceName}
+	podTargets := make(map[string]Target, len(pods))
+	for _, pod := range pods {
+		podTargets[pod.Namespace+"/"+pod.Name] = target
+	}
+	return s.searchPods(ctx, []Target{target}, pods, podTargets, opts)
+}
+
+// Search for pattern in the logs of the pods of several targets combined
+func (s *Searcher) searchTargets(ctx context.Context, opts Options) (Result, error) {
+	if opts.WatchPods {
+		return Result{}, fmt.Errorf("watching for new pods requires a single resource")
+	}
+	pods, podTargets, err := s.discoverTargetPods(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	s.warnf(VerbosityDiscovery, "Found %d pods for %s\n", len(pods), describeTargets(opts.Targets))
+	return s.searchPods(ctx, opts.Targets, pods, podTargets, opts)
+}
+
+// Search for pattern in the given pods, keyed in podTargets by namespace and name to the target
+// that selected them; new pods of the target are added with WatchPods
+func (s *Searcher) searchPods(ctx context.Context, targets []Target, pods []corev1.Pod, podTargets map[string]Target, opts Options) (Result, error) {
+	description := describeTargets(targets)
+
+	// Create a wait group to wait for all goroutines
+	var wg sync.WaitGroup
+	// Create a mutex for synchronizing access to shared resources
+	var mu sync.Mutex
+	// Create a channel to receive results
+	resultChan := make(chan PodSearchResult, len(pods))
+
+	// With CountScopeTotal, matches of all pods count towards the same threshold
+	if opts.CountScope == CountScopeTotal {
+		opts.totalCounts = make([]int32, len(opts.SearchPatterns))
+	}
+
+	// Per-pod results received so far, owned by the loop processing them
+	search := newResourceSearch(len(pods), opts)
+
+	// With OrderedOutput, the messages of each pod keyed by namespace and name, printed grouped
+	// by pod in discovery order when the search ends
+	var outputs map[string]*podOutput
+	if opts.OrderedOutput {
+		outputs = make(map[string]*podOutput, len(pods))
+	}
+
+	// Build the Result from the pod results received so far; pods still searching at the search
+	// timeout timed out
+	finish := func(found bool, err error) (Result, error) {
+		for _, pod := range pods {
+			if output := outputs[pod.Namespace+"/"+pod.Name]; output != nil {
+				output.flush()
+			}
+		}
+		result := Result{Found: found}
+		for _, pod := range pods {
+			podResult, ok := search.results[pod.Namespace+"/"+pod.Name]
+			status := podResult.Status()
+			if !ok {
+				podResult = PodSearchResult{PodName: pod.Name, Namespace: pod.Namespace, TimedOut: ctx.Err() == context.DeadlineExceeded}
+				status = PodStopped
+				if podResult.TimedOut {
+					status = PodTimedOut
+				}
+			}
+			s.progress(pod.Namespace, pod.Name, status)
+			podResult.Target = podTargets[pod.Namespace+"/"+pod.Name]
+			result.Pods = append(result.Pods, podResult)
+		}
+		return result, err
+	}
+
+	// Bound the number of log streams open at once
+	var slots chan struct{}
+	if opts.Concurrency > 0 {
+		slots = make(chan struct{}, opts.Concurrency)
+	}
+
+	// Create a context that stops the remaining pods once the outcome is decided or on timeout
+	searchCtx, cancelSearch := context.WithCancel(ctx)
+	defer cancelSearch() // Ensure context is canceled when we exit
+	// Closed once results are no longer processed, so pods finishing later don't block
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	// Report a pod's result. Every send happens before the goroutine's wg.Done and resultChan is
+	// only closed after wg.Wait, so a pod never sends on a closed channel; once results are no
+	// longer processed the send is dropped instead of blocking
+	sendResult := func(result PodSearchResult) {
+		select {
+		case resultChan <- result:
+		case <-stopped:
+		}
+	}
+
+	// Start a goroutine for a pod
+	startPod := func(pod corev1.Pod) {
+		s.progress(pod.Namespace, pod.Name, PodSearching)
+		podSearcher := s
+		if outputs != nil {
+			output := &podOutput{}
+			outputs[pod.Namespace+"/"+pod.Name] = output
+			buffered := *s
+			buffered.Stdout, buffered.Stderr = output.writer(s.Stdout), output.writer(s.Stderr)
+			podSearcher = &buffered
+		}
+		wg.Add(1)
+		go func() {
+			// Ensure WaitGroup is decremented even if panic occurs
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					fmt.Fprintf(s.Stderr, "Panic in goroutine for pod '%s': %v\n%s\n",
+						pod.Name, r, debug.Stack())
+					mu.Unlock()
+
+					// Report the panic as the pod's error
+					sendResult(PodSearchResult{
+						PodName:   pod.Name,
+						Namespace: pod.Namespace,
+						Found:     false,
+						Error:     fmt.Errorf("panic occurred: %v", r),
+					})
+				}
+				wg.Done()
+			}()
+
+			// Wait for a free slot; pods still waiting when the search ends are never started
+			if slots != nil {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-searchCtx.Done():
+					return
+				}
+			}
+
+			// Create options for this pod, which may live in another namespace with AllNamespaces
+			podOpts := opts
+			podOpts.PodName = pod.Name
+			podOpts.Namespace = pod.Namespace
+
+			// Search for pattern in this pod
+			match, err := podSearcher.searchPodWithTimeout(searchCtx, pod.Name, podOpts)
+
+			// When one match decides the search, stop the other pods right away
+			if match.found && opts.anyPodDecides() && !opts.ScanFull && !opts.StreamMatches {
+				cancelSearch()
+			}
+
+			// Collect diagnostics for the failed pod if requested
+			var diagnostic *PodDiagnostic
+			if err != nil && opts.DiagnoseOnError {
+				diagnostic = podSearcher.collectDiagnostic(pod.Name, podOpts)
+			}
+
+			sendResult(PodSearchResult{
+				PodName:     pod.Name,
+				Namespace:   pod.Namespace,
+				Found:       match.found,
+				Container:   match.container,
+				MatchedLine: match.line,
+				LineNumber:  match.lineNumber,
+				MatchedAt:   match.matchedAt,
+				Error:       err,
+				Diagnostic:  diagnostic,
+				TimedOut:    match.timedOut,
+				Matches:     match.matches,
+			})
+		}()
+	}
+
+	for _, pod := range pods {
+		startPod(pod)
+	}
+
+	// With WatchPods and RequireAll, every known pod matching only finds the pattern once the
+	// resource runs all its desired pods, since more pods of a rollout may still start
+	waitRollout := opts.WatchPods && !opts.anyPodDecides()
+	waitingRollout := false
+	decide := func() (bool, bool, error) {
+		decided, found, err := search.outcome()
+		if decided && found && waitRollout && !s.resourceRolledOut(ctx, targets[0].Type, targets[0].Name, opts) {
+			if !waitingRollout {
+				s.warnf(VerbosityDiscovery, "All %d pods matched, waiting for %s to finish rolling out\n", search.podCount, description)
+				waitingRollout = true
+			}
+			return false, false, nil
+		}
+		return decided, found, err
+	}
+	var rolloutPoll <-chan time.Time
+	if waitRollout {
+		ticker := time.NewTicker(rolloutPollInterval)
+		defer ticker.Stop()
+		rolloutPoll = ticker.C
+	}
+
+	// Pods that start running later are added to the search when watching; otherwise the result
+	// channel is closed once every pod is done, so no sender is left. With WatchPods new pods may
+	// still be started, so the channel is never closed
+	var newPods <-chan corev1.Pod
+	if opts.WatchPods {
+		newPods = s.watchResourcePods(searchCtx, targets[0].Type, targets[0].Name, opts, pods)
+	} else {
+		go func() {
+			wg.Wait()
+			close(resultChan)
+		}()
+	}
+
+	// Process results until the outcome no longer depends on the pods still searching
+	for {
+		select {
+		case pod := <-newPods:
+			pods = append(pods, pod)
+			podTargets[pod.Namespace+"/"+pod.Name] = targets[0]
+			search.podCount++
+			s.warnf(VerbosityDiscovery, "Found new pod '%s' for %s\n", podDisplayName(pod.Namespace, pod.Name, opts), description)
+			startPod(pod)
+
+		case <-rolloutPoll:
+			if decided, found, err := decide(); decided {
+				return finish(found, err)
+			}
+
+		case <-ctx.Done():
+			// Timeout reached; results delivered right before it still count
+			search.drain(resultChan)
+			if opts.ScanFull {
+				return finish(s.reportFullScan(description, search))
+			}
+			if opts.StreamMatches {
+				// The pods stop with the search: wait for them to report the lines they matched
+				cancelSearch()
+				s.collectStreamedPods(&wg, resultChan, search)
+				return finish(search.final())
+			}
+			if decided, found, err := search.outcome(); decided {
+				return finish(found, err)
+			}
+			if opts.KeepGoing {
+				// Report the errors tallied so far
+				return finish(search.final())
+			}
+			return finish(false, nil)
+
+		case result, ok := <-resultChan:
+			if !ok {
+				// All goroutines are done; pods that never reported can no longer match
+				if opts.ScanFull {
+					return finish(s.reportFullScan(description, search))
+				}
+				return finish(search.final())
+			}
+
+			search.record(result)
+			s.progress(result.Namespace, result.PodName, result.Status())
+			if result.Error != nil {
+				podName := podDisplayName(result.Namespace, result.PodName, opts)
+				stderr := s.Stderr
+				if output := outputs[result.Namespace+"/"+result.PodName]; output != nil {
+					stderr = output.writer(s.Stderr)
+				}
+				mu.Lock()
+				fmt.Fprintf(stderr, "Error searching pod '%s': %v\n", podName, result.Error)
+				if result.Diagnostic != nil {
+					WriteDiagnostic(stderr, podName, result.Diagnostic)
+				}
+				mu.Unlock()
+			}
+
+			// A full scan, or streaming matches, lasts until every pod reported or the timeout
+			if opts.ScanFull || opts.StreamMatches {
+				if search.reported() < search.podCount {
+					continue
+				}
+				if opts.ScanFull {
+					return finish(s.reportFullScan(description, search))
+				}
+				return finish(search.final())
+			}
+			if decided, found, err := decide(); decided {
+				return finish(found, err)
+			}
+		}
+	}
+}
+
+// resourceSearch holds the pod results of a resource search and decides its outcome.
+//
+// Every pod ends in one of three states: matched, failed (with an error) or ended without a
+// match (its logs ended, or it stopped at the timeout). With RequireAll the search is found once
+// every pod matched and not found as soon as one pod failed or ended without a match. With
+// RequireAny, Invert, ScanFull or CountScopeTotal it is found as soon as one pod matched (a full
+// scan still waits for every pod) and not found once every pod reported without a match. Failed
+// pods turn a not-found outcome into an error.
+type resourceSearch struct {
+	podCount int
+	opts     Options
+	// Results keyed by pod namespace and name
+	results map[string]PodSearchResult
+	matched int
+	failed  int
+}
+
+// Create the state of a search of podCount pods
+func newResourceSearch(podCount int, opts Options) *resourceSearch {
+	return &resourceSearch{
+		podCount: podCount,
+		opts:     opts,
+		results:  make(map[string]PodSearchResult, podCount),
+	}
+}
+
+// Record the result of a pod
+func (r *resourceSearch) record(result PodSearchResult) {
+	key := result.Namespace + "/" + result.PodName
+	if _, seen := r.results[key]; seen {
+		return
+	}
+	r.results[key] = result
+	switch {
+	case result.Error != nil:
+		r.failed++
+	case result.Found:
+		r.matched++
+	}
+}
+
+// Record results that were already delivered, without blocking
+func (r *resourceSearch) drain(resultChan <-chan PodSearchResult) {
+	for {
+		select {
+		case result, ok := <-resultChan:
+			if !ok {
+				return
+			}
+			r.record(result)
+		default:
+			return
+		}
+	}
+}
+
+// Number of pods that reported a result
+func (r *resourceSearch) reported() int {
+	return len(r.results)
+}
+
+// Decide the outcome, if the pods still searching can no longer change it
+func (r *resourceSearch) outcome() (decided, found bool, err error) {
+	if r.opts.anyPodDecides() {
+		if r.matched > 0 {
+			return true, true, nil
+		}
+		if r.reported() < r.podCount {
+			return false, false, nil
+		}
+	} else {
+		if r.matched == r.podCount {
+			return true, true, nil
+		}
+		if r.reported() == r.matched {
+			// Every pod that reported matched, the others may still match
+			return false, false, nil
+		}
+		if r.opts.KeepGoing && r.reported() < r.podCount {
+			// The outcome is certain, but the remaining pods still count in the error tally
+			return false, false, nil
+		}
+	}
+	found, err = r.final()
+	return true, found, err
+}
+
+// Outcome once no more results will arrive
+func (r *resourceSearch) final() (bool, error) {
+	if r.opts.anyPodDecides() && r.matched > 0 || r.matched == r.podCount {
+		return true, nil
+	}
+	if r.failed > 0 {
+		err := &PodsFailedError{PodCount: r.podCount}
+		for _, result := range r.results {
+			if result.Error != nil {
+				err.Pods = append(err.Pods, result)
+			}
+		}
+		sort.Slice(err.Pods, func(i, j int) bool {
+			a, b := err.Pods[i], err.Pods[j]
+			return a.Namespace+"/"+a.PodName < b.Namespace+"/"+b.PodName
+		})
+		err.spansNamespaces = r.opts.spansNamespaces()
+		return false, err
+	}
+	return false, nil
+}
+
+// PodsFailedError is returned when pods of a resource search failed, listing each of them with
+// its cause; errors.Is and errors.As look through the causes
+type PodsFailedError struct {
+	// Pods that failed, sorted by namespace and name
+	Pods []PodSearchResult
+	// Number of pods searched
+	PodCount int
+
+	spansNamespaces bool
+}
+
+func (e *PodsFailedError) Error() string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "failed to search logs in %d out of %d pods:", len(e.Pods), e.PodCount)
+	for _, pod := range e.Pods {
+		name := pod.PodName
+		if e.spansNamespaces {
+			name = pod.Namespace + "/" + name
+		}
+		fmt.Fprintf(&msg, "\n  %s: %v", name, pod.Error)
+	}
+	return msg.String()
+}
+
+func (e *PodsFailedError) Unwrap() []error {
+	errs := make([]error, len(e.Pods))
+	for i, pod := range e.Pods {
+		errs[i] = pod.Error
+	}
+	return errs
+}
+
+// Record the results of the pods still searching until every one of them is done
+func (s *Searcher) collectStreamedPods(wg *sync.WaitGroup, resultChan <-chan PodSearchResult, search *resourceSearch) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case result, ok := <-resultChan:
+			if !ok {
+				return
+			}
+			search.record(result)
+		case <-done:
+			search.drain(resultChan)
+			return
+		}
+	}
+}
+
+// Report every pod that matched during a full scan; any match counts as found
+func (s *Searcher) reportFullScan(description string, search *resourceSearch) (bool, error) {
+	var matchedPods []string
+	for _, result := range search.results {
+		if result.Found {
+			matchedPods = append(matchedPods, podDisplayName(result.Namespace, result.PodName, search.opts))
+		}
+	}
+	sort.Strings(matchedPods)
+
+	fmt.Fprintf(s.Stdout, "Full scan complete: pattern found in %d of %d pods for %s\n",
+		len(matchedPods), search.podCount, description)
+	for _, podName := range matchedPods {
+		fmt.Fprintf(s.Stdout, "  - %s\n", podName)
+	}
+	return search.final()
+}
@@ -0,0 +1,209 @@
+package needle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Interval between checks of whether a watched resource finished rolling out
+const rolloutPollInterval = 2 * time.Second
+
+// Watch for pods of a resource that start during the search, sending each new pod once.
+// Watch failures are reported and the watch is reopened until ctx is done.
+func (s *Searcher) watchResourcePods(ctx context.Context, resourceType ResourceType, resourceName string, opts Options, known []corev1.Pod) <-chan corev1.Pod {
+	newPods := make(chan corev1.Pod)
+
+	// Pods are identified by UID, so a recreated pod with the same name is searched again. Pods
+	// that discovery rejected, e.g. of an old ReplicaSet, are seen too so they aren't rediscovered
+	// on each of their status updates.
+	seen := make(map[types.UID]bool, len(known))
+	for _, pod := range known {
+		seen[pod.UID] = true
+	}
+
+	// Rediscover pods without repeating the discovery messages for every event
+	quiet := *s
+	quiet.Stdout = io.Discard
+	quiet.Stderr = io.Discard
+	// New pods are only sent once running, so pods still pending never fail the rediscovery
+	discoverOpts := opts
+	discoverOpts.StrictPods = false
+
+	go func() {
+		for ctx.Err() == nil {
+			err := s.watchPodEvents(ctx, resourceType, resourceName, opts, func(pod *corev1.Pod) bool {
+				if seen[pod.UID] || (pod.Status.Phase != corev1.PodRunning && !podCompleted(pod)) {
+					return true
+				}
+
+				// Let the resource's own discovery decide whether the pod belongs to it
+				pods, err := quiet.getPodsFromResource(ctx, resourceType, resourceName, discoverOpts)
+				if err != nil {
+					return true
+				}
+				for _, discovered := range pods {
+					if seen[discovered.UID] {
+						continue
+					}
+					seen[discovered.UID] = true
+					select {
+					case newPods <- discovered:
+					case <-ctx.Done():
+						return false
+					}
+				}
+				// Whether discovery kept the pod or not, its later updates don't change that
+				seen[pod.UID] = true
+				return true
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			fmt.Fprintf(s.Stderr, "Watching pods of %s '%s' failed: %v, retrying\n", resourceType, resourceName, err)
+
+			select {
+			case <-time.After(reconnectBackoff):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return newPods
+}
+
+// Watch the pods that may belong to a resource, calling handle for every added or modified pod
+// until it returns false or the watch ends
+func (s *Searcher) watchPodEvents(ctx context.Context, resourceType ResourceType, resourceName string, opts Options, handle func(pod *corev1.Pod) bool) error {
+	selector, err := s.resourceLabelSelector(ctx, resourceType, resourceName, opts)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := s.streamClient().CoreV1().Pods(opts.searchNamespace()).Watch(ctx, metav1.ListOptions{LabelSelector: selector, FieldSelector: opts.FieldSelector})
+	if err != nil {
+		return fmt.Errorf("failed to watch pods: %w", err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return fmt.Errorf("watch closed by the API server")
+			}
+			switch event.Type {
+			case watch.Error:
+				return fmt.Errorf("watch error: %v", event.Object)
+			case watch.Added, watch.Modified:
+				pod, ok := event.Object.(*corev1.Pod)
+				if ok && !handle(pod) {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// Label selector of the pods that may belong to a resource
+func (s *Searcher) resourceLabelSelector(ctx context.Context, resourceType ResourceType, resourceName string, opts Options) (string, error) {
+	namespace := opts.searchNamespace()
+	switch resourceType {
+	case ResourceTypeDeployment:
+		deployment, err := retryAPI(ctx, s, opts, func() (*appsv1.Deployment, error) {
+			return s.client.AppsV1().Deployments(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return "", lookupError("deployment", resourceName, namespace, err)
+		}
+		return labels.SelectorFromSet(deployment.Spec.Selector.MatchLabels).String(), nil
+	case ResourceTypeStatefulSet:
+		statefulSet, err := retryAPI(ctx, s, opts, func() (*appsv1.StatefulSet, error) {
+			return s.client.AppsV1().StatefulSets(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return "", lookupError("statefulset", resourceName, namespace, err)
+		}
+		return labels.SelectorFromSet(statefulSet.Spec.Selector.MatchLabels).String(), nil
+	case ResourceTypeDaemonSet:
+		daemonSet, err := retryAPI(ctx, s, opts, func() (*appsv1.DaemonSet, error) {
+			return s.client.AppsV1().DaemonSets(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return "", lookupError("daemonset", resourceName, namespace, err)
+		}
+		return labels.SelectorFromSet(daemonSet.Spec.Selector.MatchLabels).String(), nil
+	case ResourceTypeJob:
+		return labels.SelectorFromSet(labels.Set{batchv1.JobNameLabel: resourceName}).String(), nil
+	case ResourceTypeCronJob:
+		// The pods of any job; discovery keeps those of the cronjob's most recent one
+		return batchv1.JobNameLabel, nil
+	case ResourceTypeDeploymentConfig:
+		// The pods of any version; discovery keeps those of the active one
+		return labels.SelectorFromSet(labels.Set{deploymentConfigLabel: resourceName}).String(), nil
+	case ResourceTypeSelector:
+		return resourceName, nil
+	case ResourceTypePod:
+		// Every pod; discovery keeps those whose name matches the pattern
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported resource type: %s", resourceType)
+}
+
+// Check whether a resource runs all its desired pods on its latest template, so that no pod of a
+// rollout is still to come. Resources without a desired pod count, such as jobs and label
+// selectors, count as rolled out; a failed lookup doesn't.
+func (s *Searcher) resourceRolledOut(ctx context.Context, resourceType ResourceType, resourceName string, opts Options) bool {
+	namespace := opts.searchNamespace()
+	switch resourceType {
+	case ResourceTypeDeployment:
+		deployment, err := retryAPI(ctx, s, opts, func() (*appsv1.Deployment, error) {
+			return s.client.AppsV1().Deployments(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return false
+		}
+		desired := desiredReplicas(deployment.Spec.Replicas)
+		status := deployment.Status
+		// Pods of older ReplicaSets are gone once every replica is updated
+		return status.ObservedGeneration >= deployment.Generation && status.UpdatedReplicas >= desired && status.Replicas == status.UpdatedReplicas
+	case ResourceTypeStatefulSet:
+		statefulSet, err := retryAPI(ctx, s, opts, func() (*appsv1.StatefulSet, error) {
+			return s.client.AppsV1().StatefulSets(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return false
+		}
+		status := statefulSet.Status
+		return status.ObservedGeneration >= statefulSet.Generation && status.UpdatedReplicas >= desiredReplicas(statefulSet.Spec.Replicas)
+	case ResourceTypeDaemonSet:
+		daemonSet, err := retryAPI(ctx, s, opts, func() (*appsv1.DaemonSet, error) {
+			return s.client.AppsV1().DaemonSets(namespace).Get(ctx, resourceName, metav1.GetOptions{})
+		})
+		if err != nil {
+			return false
+		}
+		status := daemonSet.Status
+		return status.ObservedGeneration >= daemonSet.Generation && status.UpdatedNumberScheduled >= status.DesiredNumberScheduled
+	}
+	return true
+}
+
+// Desired replicas of a workload, which default to one
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// ANSI escapes used to redraw the progress lines in place
+const (
+	ansiCursorUp   = "\x1b[%dA"
+	ansiClearToEnd = "\x1b[J"
+)
+
+// Indentation of the progress lines
+const progressPadding = 2
+
+// progressDisplay keeps a live status line per pod of a resource search at the bottom of a
+// terminal. Messages written through its writers are printed above the status lines.
+type progressDisplay struct {
+	mu     sync.Mutex
+	out    io.Writer
+	keys   []string
+	names  map[string]string
+	status map[string]needle.PodStatus
+	// Number of status lines currently on screen
+	drawn   int
+	stopped bool
+}
+
+// Create a progress display drawing to out, a terminal
+func newProgressDisplay(out io.Writer) *progressDisplay {
+	return &progressDisplay{
+		out:    out,
+		names:  make(map[string]string),
+		status: make(map[string]needle.PodStatus),
+	}
+}
+
+// Check whether the progress lines replace the scrolling per-pod messages of a search
+func useProgress(args Args) bool {
+	if reportOutput(args) || args.Quiet || singlePod(args) || args.Interval > 0 ||
+		args.Verbosity >= int(needle.VerbosityLogs) {
+		return false
+	}
+	switch args.Progress {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	return isTerminal(infoOutput(args))
+}
+
+// Record the status of a pod and redraw the status lines
+func (p *progressDisplay) update(namespace, podName string, status needle.PodStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := namespace + "/" + podName
+	if _, ok := p.status[key]; !ok {
+		p.keys = append(p.keys, key)
+		p.names[key] = podName
+	}
+	p.status[key] = status
+	if p.stopped {
+		return
+	}
+	p.erase()
+	p.draw()
+}
+
+// Writer printing messages above the status lines of the display
+func (p *progressDisplay) writer(w io.Writer) io.Writer {
+	return progressWriter{display: p, out: w}
+}
+
+// Leave the final status lines on screen; later messages are printed below them
+func (p *progressDisplay) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped = true
+	p.drawn = 0
+}
+
+// Move the cursor back over the status lines and clear them
+func (p *progressDisplay) erase() {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.out, ansiCursorUp+"\r"+ansiClearToEnd, p.drawn)
+		p.drawn = 0
+	}
+}
+
+// Print a status line per pod
+func (p *progressDisplay) draw() {
+	width := 0
+	for _, key := range p.keys {
+		width = max(width, len(p.names[key]))
+	}
+	var lines strings.Builder
+	for _, key := range p.keys {
+		status := string(p.status[key])
+		if p.status[key] == needle.PodSearching {
+			status += "..."
+		}
+		fmt.Fprintf(&lines, "%*s%-*s %s\n", progressPadding, "", width, p.names[key], status)
+	}
+	io.WriteString(p.out, lines.String())
+	p.drawn = len(p.keys)
+}
+
+// progressWriter prints messages above the status lines of a progress display
+type progressWriter struct {
+	display *progressDisplay
+	out     io.Writer
+}
+
+func (w progressWriter) Write(b []byte) (int, error) {
+	p := w.display
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.erase()
+	n, err := w.out.Write(b)
+	if !p.stopped && len(p.keys) > 0 {
+		p.draw()
+	}
+	return n, err
+}
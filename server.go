@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// How long in-flight requests may take once the server is shut down
+const serverShutdownTimeout = 5 * time.Second
+
+// Start the metrics and health servers asked for, sharing one server when both use the same
+// address. The returned channel is closed once they are all shut down after ctx is done.
+func startServers(ctx context.Context, args Args, metrics *needle.Metrics) (<-chan struct{}, error) {
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if args.MetricsAddr != "" {
+		mux(args.MetricsAddr).Handle("/metrics", metrics)
+	}
+	if args.HealthAddr != "" {
+		mux(args.HealthAddr).HandleFunc("/healthz", serveHealth)
+	}
+
+	var served []<-chan struct{}
+	for addr, handler := range muxes {
+		done, err := serveHTTP(ctx, addr, handler)
+		if err != nil {
+			return nil, err
+		}
+		served = append(served, done)
+	}
+
+	allDone := make(chan struct{})
+	go func() {
+		defer close(allDone)
+		for _, done := range served {
+			<-done
+		}
+	}()
+	return allDone, nil
+}
+
+// Report that the process is alive, for liveness probes
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// Serve handler on addr until ctx is done, then shut the server down and close the returned
+// channel. Failing to listen on addr is reported before anything is served.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) (<-chan struct{}, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		server.Serve(listener)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+		case <-served:
+			return
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+		<-served
+	}()
+	return done, nil
+}
@@ -0,0 +1,329 @@
+//go:build tui
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+	"golang.org/x/term"
+)
+
+// tuiAvailable reports whether the binary was built with TUI support
+const tuiAvailable = true
+
+// Number of recent log lines kept per pod for the drill-down view
+const tuiTailLines = 500
+
+// Interval between screen refreshes
+const tuiRefreshInterval = 250 * time.Millisecond
+
+// ANSI escape sequences used by the TUI
+const (
+	ansiAltScreenOn  = "\x1b[?1049h"
+	ansiAltScreenOff = "\x1b[?1049l"
+	ansiHideCursor   = "\x1b[?25l"
+	ansiShowCursor   = "\x1b[?25h"
+	ansiClearScreen  = "\x1b[H\x1b[2J"
+	ansiReverse      = "\x1b[7m"
+	ansiReset        = "\x1b[0m"
+)
+
+// tuiPodState tracks the live search state of a single pod
+type tuiPodState struct {
+	name      string
+	namespace string
+	status    string
+	lines     int
+	matches   int
+	err       error
+	tail      []string
+}
+
+// tuiModel holds the shared state rendered by the TUI
+type tuiModel struct {
+	mu       sync.Mutex
+	args     Args
+	started  time.Time
+	pods     []*tuiPodState
+	selected int
+	viewLogs bool
+}
+
+// Run the interactive TUI until the user quits or the context is canceled
+func runTUI(ctx context.Context, searcher *needle.Searcher, args Args) error {
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+	if !term.IsTerminal(stdinFd) || !term.IsTerminal(stdoutFd) {
+		return fmt.Errorf("TUI mode requires an interactive terminal")
+	}
+
+	// Discover the pods to watch before taking over the terminal
+	pods, err := searcher.DiscoverPods(ctx, args.Options)
+	if err != nil {
+		return err
+	}
+
+	model := &tuiModel{args: args, started: time.Now()}
+	for _, pod := range pods {
+		model.pods = append(model.pods, &tuiPodState{name: pod.Name, namespace: pod.Namespace, status: "searching"})
+	}
+
+	oldState, err := term.MakeRaw(stdinFd)
+	if err != nil {
+		return fmt.Errorf("failed to put terminal into raw mode: %v", err)
+	}
+	fmt.Print(ansiAltScreenOn + ansiHideCursor)
+	defer func() {
+		fmt.Print(ansiShowCursor + ansiAltScreenOff)
+		term.Restore(stdinFd, oldState)
+	}()
+
+	tuiCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Stream logs of every pod concurrently
+	for _, state := range model.pods {
+		go model.streamPod(tuiCtx, searcher, state)
+	}
+
+	// Read key presses in the background
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 8)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case keys <- string(buf[:n]):
+			case <-tuiCtx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	model.render(stdoutFd)
+	for {
+		select {
+		case <-tuiCtx.Done():
+			return nil
+		case key := <-keys:
+			if !model.handleKey(key) {
+				return nil
+			}
+			model.render(stdoutFd)
+		case <-ticker.C:
+			model.render(stdoutFd)
+		}
+	}
+}
+
+// Stream a pod's logs, updating its state for every line read
+func (m *tuiModel) streamPod(ctx context.Context, searcher *needle.Searcher, state *tuiPodState) {
+	// Pods found with -all-namespaces live in their own namespace
+	opts := m.args.Options
+	opts.Namespace = state.namespace
+	podLogs, err := searcher.OpenLogStream(ctx, state.name, opts)
+	if err != nil {
+		m.setError(state, err)
+		return
+	}
+	defer podLogs.Close()
+
+	reader := bufio.NewReader(podLogs)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			m.addLine(state, strings.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			// Logs that aren't followed, of a previous instance or of a finished pod simply end
+			m.setDone(state)
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				m.setError(state, fmt.Errorf("error reading logs: %v", err))
+			}
+			return
+		}
+	}
+}
+
+// Record a log line for a pod and update its match status
+func (m *tuiModel) addLine(state *tuiPodState, line string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state.lines++
+	if len(m.args.MatchLine(line)) > 0 {
+		state.matches++
+		state.status = "matched"
+	}
+	state.tail = append(state.tail, line)
+	if len(state.tail) > tuiTailLines {
+		state.tail = state.tail[len(state.tail)-tuiTailLines:]
+	}
+}
+
+// Mark a pod whose logs ended, keeping its match status
+func (m *tuiModel) setDone(state *tuiPodState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state.matches == 0 {
+		state.status = string(needle.PodNoMatch)
+	}
+}
+
+// Mark a pod as failed
+func (m *tuiModel) setError(state *tuiPodState, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state.status = "error"
+	state.err = err
+}
+
+// Apply a key press, returning false when the user asked to quit
+func (m *tuiModel) handleKey(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch key {
+	case "q", "\x03":
+		return false
+	case "k", "\x1b[A":
+		if !m.viewLogs && m.selected > 0 {
+			m.selected--
+		}
+	case "j", "\x1b[B":
+		if !m.viewLogs && m.selected < len(m.pods)-1 {
+			m.selected++
+		}
+	case "\r", "\n":
+		m.viewLogs = true
+	case "\x1b", "b", "\x7f":
+		m.viewLogs = false
+	}
+	return true
+}
+
+// Redraw the whole screen
+func (m *tuiModel) render(fd int) {
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString(ansiClearScreen)
+
+	if m.viewLogs {
+		m.renderLogs(&sb, width, height)
+	} else {
+		m.renderPods(&sb, width, height)
+	}
+
+	fmt.Print(sb.String())
+}
+
+// Render the pod list with match status and line counts
+func (m *tuiModel) renderPods(sb *strings.Builder, width, height int) {
+	elapsed := time.Since(m.started).Truncate(time.Second)
+	namespace := m.args.Namespace
+	if m.args.AllNamespaces {
+		namespace = "all"
+	} else if m.args.NamespaceSelector != "" {
+		namespace = m.args.NamespaceSelector
+	}
+	writeTUILine(sb, fmt.Sprintf("klogs-needle  needle: %s  namespace: %s  elapsed: %s",
+		describePatterns(m.args), namespace, elapsed), width)
+	writeTUILine(sb, "", width)
+	writeTUILine(sb, fmt.Sprintf("  %-40s %-10s %10s %8s", "POD", "STATUS", "LINES", "MATCHES"), width)
+
+	// Leave room for the header and the key help
+	visible := height - 5
+	start := 0
+	if m.selected >= visible {
+		start = m.selected - visible + 1
+	}
+	for i := start; i < len(m.pods) && i < start+visible; i++ {
+		pod := m.pods[i]
+		cursor := " "
+		if i == m.selected {
+			cursor = ">"
+		}
+		row := fmt.Sprintf("%s %-40s %-10s %10d %8d", cursor, m.podLabel(pod), pod.status, pod.lines, pod.matches)
+		if pod.err != nil {
+			row += "  " + pod.err.Error()
+		}
+		writeTUILine(sb, row, width)
+	}
+
+	writeTUILine(sb, "", width)
+	sb.WriteString("up/down select  enter view logs  q quit")
+}
+
+// Render the recent log lines of the selected pod with the needle highlighted
+func (m *tuiModel) renderLogs(sb *strings.Builder, width, height int) {
+	pod := m.pods[m.selected]
+	writeTUILine(sb, fmt.Sprintf("pod: %s  status: %s  lines: %d  matches: %d",
+		m.podLabel(pod), pod.status, pod.lines, pod.matches), width)
+	writeTUILine(sb, "", width)
+
+	// Leave room for the header and the key help
+	visible := height - 4
+	tail := pod.tail
+	if len(tail) > visible {
+		tail = tail[len(tail)-visible:]
+	}
+	for _, line := range tail {
+		sb.WriteString(m.args.HighlightMatches(truncateLine(line, width), ansiReverse, ansiReset))
+		sb.WriteString("\r\n")
+	}
+	for i := len(tail); i < visible; i++ {
+		sb.WriteString("\r\n")
+	}
+
+	writeTUILine(sb, "", width)
+	sb.WriteString("esc/b back  q quit")
+}
+
+// Name a pod, qualified with its namespace when searching several namespaces
+func (m *tuiModel) podLabel(pod *tuiPodState) string {
+	if spansNamespaces(m.args) {
+		return pod.namespace + "/" + pod.name
+	}
+	return pod.name
+}
+
+// Write a line truncated to the terminal width, using raw-mode line endings
+func writeTUILine(sb *strings.Builder, line string, width int) {
+	sb.WriteString(truncateLine(line, width))
+	sb.WriteString("\r\n")
+}
+
+// Cut a line to at most width characters, without splitting a multi-byte character
+func truncateLine(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width])
+}
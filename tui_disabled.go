@@ -0,0 +1,18 @@
+//go:build !tui
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// tuiAvailable reports whether the binary was built with TUI support
+const tuiAvailable = false
+
+// runTUI is only available when built with the tui build tag
+func runTUI(ctx context.Context, searcher *needle.Searcher, args Args) error {
+	return fmt.Errorf("TUI support is not compiled in, rebuild with -tags tui")
+}
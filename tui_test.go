@@ -0,0 +1,50 @@
+//go:build tui
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTUIStreamEndsWithPreviousLogs(t *testing.T) {
+	// The fake clientset serves "fake logs" as every pod's logs, ending them with EOF
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "app", RestartCount: 1}},
+		},
+	}
+	searcher := needle.NewSearcher(fake.NewClientset(pod))
+
+	for _, tt := range []struct {
+		needle     string
+		wantStatus string
+	}{
+		{needle: "fake", wantStatus: string(needle.PodMatched)},
+		{needle: "Service started", wantStatus: string(needle.PodNoMatch)},
+	} {
+		args := Args{}
+		args.Namespace = "default"
+		args.SearchPatterns = []string{tt.needle}
+		args.Previous = true
+		model := &tuiModel{args: args}
+		state := &tuiPodState{name: "web", namespace: "default", status: "searching"}
+
+		model.streamPod(context.Background(), searcher, state)
+
+		if state.err != nil || state.status != tt.wantStatus {
+			t.Errorf("needle %q: status = %q, err = %v; want %q", tt.needle, state.status, state.err, tt.wantStatus)
+		}
+		if state.lines != 1 {
+			t.Errorf("needle %q: read %d lines, want 1", tt.needle, state.lines)
+		}
+	}
+}
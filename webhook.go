@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rogosprojects/klogs-needle/pkg/needle"
+)
+
+// How long a webhook may take to accept a notification
+const webhookTimeout = 10 * time.Second
+
+// webhookPayload is the JSON body posted to -webhook-url when the pattern is found
+type webhookPayload struct {
+	Resource  *jsonResource  `json:"resource,omitempty"`
+	Resources []jsonResource `json:"resources,omitempty"`
+	Patterns  []string       `json:"patterns"`
+	Matches   []webhookMatch `json:"matches"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// webhookMatch is a pod whose logs matched
+type webhookMatch struct {
+	Pod         string        `json:"pod"`
+	Namespace   string        `json:"namespace,omitempty"`
+	MatchedLine string        `json:"matchedLine,omitempty"`
+	Resource    *jsonResource `json:"resource,omitempty"`
+}
+
+// slackMessage is the body of a Slack incoming-webhook message
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Notify the configured webhooks of a search that found the pattern, only warning about
+// delivery failures
+func notifyMatch(w io.Writer, args Args, result needle.Result, elapsed time.Duration) {
+	if args.WebhookURL != "" {
+		if err := notifyWebhook(args.WebhookURL, args, result); err != nil {
+			fmt.Fprintf(w, "Warning: %v\n", err)
+		}
+	}
+	if args.SlackWebhook != "" {
+		if err := notifySlack(args.SlackWebhook, args, result, elapsed); err != nil {
+			fmt.Fprintf(w, "Warning: %v\n", err)
+		}
+	}
+}
+
+// Post the matching pods of a search to the webhook
+func notifyWebhook(url string, args Args, result needle.Result) error {
+	payload := webhookPayload{
+		Resource:  searchedResource(args),
+		Resources: searchedTargets(args),
+		Patterns:  args.SearchPatterns,
+		Matches:   []webhookMatch{},
+		Timestamp: time.Now().UTC(),
+	}
+	for _, pod := range result.Pods {
+		if pod.Found {
+			payload.Matches = append(payload.Matches, webhookMatch{Pod: pod.PodName, Namespace: pod.Namespace, MatchedLine: pod.MatchedLine, Resource: podTarget(args, pod)})
+		}
+	}
+
+	return postJSON(url, "webhook", payload)
+}
+
+// Post a Slack message naming the pattern, the target, the matching pods and the elapsed time
+func notifySlack(url string, args Args, result needle.Result, elapsed time.Duration) error {
+	patterns := "`" + strings.Join(args.SearchPatterns, "`, `") + "`"
+	text := fmt.Sprintf("Found %s in %s after %s", patterns, slackTarget(args), elapsed.Round(100*time.Millisecond))
+	if !singlePod(args) {
+		if matched := result.MatchedPods(); len(matched) > 0 {
+			text += "\nMatching pods: `" + strings.Join(matched, "`, `") + "`"
+		}
+	}
+	return postJSON(url, "Slack webhook", slackMessage{Text: text})
+}
+
+// The searched pod or resource in a Slack message, e.g. "pod X of deployment Y"
+func slackTarget(args Args) string {
+	namespace := ""
+	if args.NamespaceSelector != "" {
+		namespace = fmt.Sprintf(" in namespaces matching `%s`", args.NamespaceSelector)
+	} else if !args.AllNamespaces {
+		namespace = fmt.Sprintf(" in namespace `%s`", args.Namespace)
+	}
+	if needle.IsPodPattern(args.PodName) {
+		return fmt.Sprintf("pods matching `%s`%s", args.PodName, namespace)
+	}
+	if args.PodName != "" {
+		return fmt.Sprintf("pod `%s`%s", args.PodName, namespace)
+	}
+	if len(args.Targets) > 0 {
+		targets := make([]string, len(args.Targets))
+		for i, target := range args.Targets {
+			targets[i] = fmt.Sprintf("%s `%s`", target.Type, target.Name)
+		}
+		return strings.Join(targets, ", ") + namespace
+	}
+	resourceType, resourceName := args.Resource()
+	return fmt.Sprintf("%s `%s`%s", resourceType, resourceName, namespace)
+}
+
+// Post a JSON body to a notification endpoint, named in errors
+func postJSON(url, name string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s payload: %v", name, err)
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s responded with status %s", name, resp.Status)
+	}
+	return nil
+}